@@ -0,0 +1,665 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	archiveFormat = "movies-catalog"
+	// Version 2 added movie genres, version 3 ratings, version 4 the
+	// watchlist and watch history, version 5 moved those into user profiles
+	// and added notes, version 6 added crew credits, version 7 characters
+	// and billing order, version 8 TMDb IDs, version 9 full dates and
+	// version 10 movies without a director.
+	archiveVersion = 10
+)
+
+// catalogArchive is the layout of an `export` file. IDs are only meaningful
+// within the archive; restore assigns new ones.
+type catalogArchive struct {
+	Format      string           `json:"format"`
+	Version     int              `json:"version"`
+	ExportedAt  time.Time        `json:"exported_at"`
+	People      []archivePerson  `json:"people"`
+	Movies      []archiveMovie   `json:"movies"`
+	MovieActors []archiveCasting `json:"movie_actors"`
+	Credits     []archiveCredit  `json:"credits,omitempty"`
+	Users       []archiveUser    `json:"users"`
+}
+
+type archivePerson struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	BirthYear *int   `json:"birth_year"`           // null when unknown
+	BirthDate string `json:"birth_date,omitempty"` // YYYY-MM-DD
+	DeathDate string `json:"death_date,omitempty"`
+	TMDbID    int    `json:"tmdb_id,omitempty"`
+}
+
+type archiveMovie struct {
+	ID            int      `json:"id"`
+	Title         string   `json:"title"`
+	DirectorID    int      `json:"director_id"` // 0 when it has none
+	ReleaseYear   int      `json:"release_year"`
+	ReleaseDate   string   `json:"release_date,omitempty"` // YYYY-MM-DD
+	LengthMinutes int      `json:"length_minutes"`
+	Genres        []string `json:"genres,omitempty"`
+	TMDbID        int      `json:"tmdb_id,omitempty"`
+
+	// Before version 5 the single user's data was stored with the movie
+	archiveUserMovie
+}
+
+type archiveUser struct {
+	Name   string             `json:"name"`
+	Movies []archiveUserMovie `json:"movies"`
+}
+
+// archiveUserMovie is one user's data about a movie.
+type archiveUserMovie struct {
+	MovieID       int            `json:"movie_id,omitempty"`
+	Rating        *archiveRating `json:"rating,omitempty"`
+	Note          *archiveNote   `json:"note,omitempty"`
+	WatchlistedAt *time.Time     `json:"watchlisted_at,omitempty"` // set while on the watchlist
+	Viewings      []string       `json:"viewings,omitempty"`       // YYYY-MM-DD
+}
+
+type archiveRating struct {
+	Score   int       `json:"score"`
+	Review  string    `json:"review,omitempty"`
+	RatedAt time.Time `json:"rated_at"`
+}
+
+type archiveNote struct {
+	Text      string    `json:"text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type archiveCasting struct {
+	MovieID   int    `json:"movie_id"`
+	ActorID   int    `json:"actor_id"`
+	Character string `json:"character,omitempty"`
+	Order     int    `json:"order,omitempty"` // billing position from 1
+}
+
+// archiveCredit is a crew credit. Before version 6 only the director of
+// each movie was known.
+type archiveCredit struct {
+	MovieID  int    `json:"movie_id"`
+	PersonID int    `json:"person_id"`
+	Job      string `json:"job"`
+}
+
+func runExportCommand(args []string) error {
+	fs := newCommandFlagSet("export")
+	compress := fs.Bool("gzip", false, "gzip the archive (implied by a .gz file name)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError{"usage: export [-gzip] FILE (- for stdout)"}
+	}
+	path := rest[0]
+
+	return withCatalog(func(store MovieStore) error {
+		archive, err := exportCatalog(store)
+		if err != nil {
+			return err
+		}
+		if err := writeArchive(path, archive, *compress || strings.HasSuffix(path, ".gz")); err != nil {
+			return err
+		}
+		if path != "-" {
+			fmt.Printf("Exported %d people, %d movies and %d cast links to %s.\n",
+				len(archive.People), len(archive.Movies), len(archive.MovieActors), path)
+		}
+		return nil
+	})
+}
+
+func runRestoreCommand(args []string) error {
+	if len(args) != 1 {
+		return usageError{"usage: restore FILE (- for stdin)"}
+	}
+
+	archive, err := readArchive(args[0])
+	if err != nil {
+		return err
+	}
+	return withCatalog(func(store MovieStore) error {
+		return restoreCatalog(store, archive)
+	})
+}
+
+// exportCatalog reads the whole catalog into an archive.
+func exportCatalog(store MovieStore) (*catalogArchive, error) {
+	archive := &catalogArchive{
+		Format:      archiveFormat,
+		Version:     archiveVersion,
+		ExportedAt:  time.Now().UTC().Truncate(time.Second),
+		People:      []archivePerson{},
+		Movies:      []archiveMovie{},
+		MovieActors: []archiveCasting{},
+	}
+
+	people, err := store.People()
+	if err != nil {
+		return nil, fmt.Errorf("reading people: %w", err)
+	}
+	for _, p := range people {
+		archive.People = append(archive.People, toArchivePerson(p))
+	}
+
+	movies, err := store.Movies()
+	if err != nil {
+		return nil, fmt.Errorf("reading movies: %w", err)
+	}
+	for _, m := range movies {
+		genres, err := store.MovieGenres(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("reading genres: %w", err)
+		}
+		archive.Movies = append(archive.Movies, toArchiveMovie(m, genres))
+	}
+
+	links, err := store.CastLinks()
+	if err != nil {
+		return nil, fmt.Errorf("reading cast: %w", err)
+	}
+	for _, link := range links {
+		archive.MovieActors = append(archive.MovieActors, archiveCasting{MovieID: link.MovieID, ActorID: link.ActorID, Character: link.Character, Order: link.Order})
+	}
+
+	credits, err := store.Credits()
+	if err != nil {
+		return nil, fmt.Errorf("reading crew: %w", err)
+	}
+	for _, c := range credits {
+		archive.Credits = append(archive.Credits, archiveCredit{MovieID: c.MovieID, PersonID: c.PersonID, Job: c.Job})
+	}
+
+	users, err := store.Users()
+	if err != nil {
+		return nil, fmt.Errorf("reading users: %w", err)
+	}
+	current := store.CurrentUser()
+	defer store.SwitchUser(current)
+	for _, name := range users {
+		if _, err := store.SwitchUser(name); err != nil {
+			return nil, err
+		}
+		user, err := exportUser(store, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading data of user %s: %w", name, err)
+		}
+		archive.Users = append(archive.Users, *user)
+	}
+	return archive, nil
+}
+
+func toArchivePerson(p Person) archivePerson {
+	return archivePerson{
+		ID:        p.ID,
+		Name:      p.Name,
+		BirthYear: optionalInt(p.BirthYear),
+		BirthDate: formatDate(p.BirthDate),
+		DeathDate: formatDate(p.DeathDate),
+		TMDbID:    p.TMDbID,
+	}
+}
+
+func toArchiveMovie(m Movie, genres []string) archiveMovie {
+	return archiveMovie{
+		ID:            m.ID,
+		Title:         m.Title,
+		DirectorID:    m.DirectorID,
+		ReleaseYear:   m.ReleaseYear,
+		ReleaseDate:   formatDate(m.ReleaseDate),
+		LengthMinutes: m.LengthMinutes,
+		Genres:        genres,
+		TMDbID:        m.TMDbID,
+	}
+}
+
+// exportUser collects the current user's ratings, notes, watchlist and
+// history.
+func exportUser(store MovieStore, name string) (*archiveUser, error) {
+	byMovie := map[int]*archiveUserMovie{}
+	entry := func(movieID int) *archiveUserMovie {
+		if byMovie[movieID] == nil {
+			byMovie[movieID] = &archiveUserMovie{MovieID: movieID}
+		}
+		return byMovie[movieID]
+	}
+
+	rated, err := store.ListMovies(MovieFilter{MinRating: 1})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range rated {
+		r := m.Rating
+		entry(m.ID).Rating = &archiveRating{Score: r.Score, Review: r.Review, RatedAt: r.RatedAt.UTC()}
+	}
+
+	notes, err := store.Notes()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		entry(n.MovieID).Note = &archiveNote{Text: n.Text, UpdatedAt: n.UpdatedAt.UTC()}
+	}
+
+	watchlist, err := store.Watchlist()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range watchlist {
+		addedAt := e.Date.UTC()
+		entry(e.MovieID).WatchlistedAt = &addedAt
+	}
+
+	history, err := store.Viewings()
+	if err != nil {
+		return nil, err
+	}
+	// Oldest viewing first
+	for i := len(history) - 1; i >= 0; i-- {
+		e := entry(history[i].MovieID)
+		e.Viewings = append(e.Viewings, history[i].Date.Format("2006-01-02"))
+	}
+
+	user := &archiveUser{Name: name, Movies: []archiveUserMovie{}}
+	for _, e := range byMovie {
+		user.Movies = append(user.Movies, *e)
+	}
+	sort.Slice(user.Movies, func(i, j int) bool { return user.Movies[i].MovieID < user.Movies[j].MovieID })
+	return user, nil
+}
+
+func writeArchive(path string, archive *catalogArchive, compress bool) (err error) {
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = file
+	}
+
+	if compress {
+		zw := gzip.NewWriter(out)
+		defer func() {
+			if cerr := zw.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = zw
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
+
+// readArchive reads a plain or gzipped archive and checks its version.
+func readArchive(path string) (*catalogArchive, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	buffered := bufio.NewReader(in)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		defer zr.Close()
+		in = zr
+	} else {
+		in = buffered
+	}
+
+	var archive catalogArchive
+	if err := json.NewDecoder(in).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if archive.Format != archiveFormat {
+		return nil, fmt.Errorf("%s is not a catalog archive", path)
+	}
+	if archive.Version < 1 || archive.Version > archiveVersion {
+		return nil, fmt.Errorf("%s has archive version %d, this build reads up to version %d", path, archive.Version, archiveVersion)
+	}
+
+	if archive.Version < 5 {
+		// Older archives hold one anonymous user's data, which is restored
+		// for the current user
+		user := archiveUser{}
+		for i, m := range archive.Movies {
+			if m.Rating != nil || m.WatchlistedAt != nil || len(m.Viewings) > 0 {
+				data := m.archiveUserMovie
+				data.MovieID = m.ID
+				user.Movies = append(user.Movies, data)
+			}
+			archive.Movies[i].archiveUserMovie = archiveUserMovie{}
+		}
+		archive.Users = []archiveUser{user}
+	}
+	return &archive, nil
+}
+
+// restoreUser adds one user's data for the current user. Ratings and notes
+// already in the catalog win over archived ones, and viewings already logged
+// are not logged twice.
+func restoreUser(tx MovieStore, user archiveUser, movieIDs map[int]int) error {
+	history, err := tx.Viewings()
+	if err != nil {
+		return err
+	}
+	logged := map[watchKey]int{}
+	for _, e := range history {
+		logged[watchKey{e.MovieID, e.Date.Format("2006-01-02")}]++
+	}
+
+	for _, m := range user.Movies {
+		id, ok := movieIDs[m.MovieID]
+		if !ok {
+			return fmt.Errorf("%w: user data for unknown movie ID %d", errBadArchive, m.MovieID)
+		}
+
+		if r := m.Rating; r != nil {
+			existing, err := tx.MovieByID(id)
+			if err != nil {
+				return err
+			}
+			if existing.Rating == nil {
+				if err := tx.RateMovie(id, Rating{Score: r.Score, Review: r.Review, RatedAt: r.RatedAt}); err != nil {
+					return fmt.Errorf("restoring rating of '%s': %w", existing.Title, err)
+				}
+			}
+		}
+		if n := m.Note; n != nil {
+			if _, err := tx.MovieNote(id); errors.Is(err, ErrNotFound) {
+				if err := tx.SetNote(id, n.Text, n.UpdatedAt); err != nil {
+					return fmt.Errorf("restoring note: %w", err)
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+		if m.WatchlistedAt != nil {
+			if _, err := tx.AddToWatchlist(id, *m.WatchlistedAt); err != nil {
+				return fmt.Errorf("restoring watchlist: %w", err)
+			}
+		}
+		for _, day := range m.Viewings {
+			watchedOn, err := time.Parse("2006-01-02", day)
+			if err != nil {
+				return fmt.Errorf("%w: bad viewing date %q", errBadArchive, day)
+			}
+			key := watchKey{id, day}
+			if logged[key] > 0 {
+				logged[key]--
+				continue
+			}
+			if err := tx.LogViewing(id, watchedOn); err != nil {
+				return fmt.Errorf("restoring watch history: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// watchKey identifies the viewings of a movie on one day.
+type watchKey struct {
+	movieID int
+	day     string
+}
+
+var errBadArchive = errors.New("archive is inconsistent")
+
+// archiveDate parses an optional YYYY-MM-DD date of an archive.
+func archiveDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return parseDate(s)
+}
+
+// restoredPerson returns the catalog person an archived one is, or nil. A
+// TMDb ID must match exactly; people without one match on their exact name
+// and birth year, an unknown birth year matching only an unknown one. Each
+// catalog person stands for at most one archived person, so namesakes the
+// archive tells apart stay apart.
+func restoredPerson(catalog []Person, p Person, taken map[int]bool) *Person {
+	for i := range catalog {
+		c := &catalog[i]
+		if taken[c.ID] || c.TMDbID != p.TMDbID {
+			continue
+		}
+		if p.TMDbID != 0 || (c.Name == p.Name && c.BirthYear == p.BirthYear) {
+			return c
+		}
+	}
+	return nil
+}
+
+// movieKey is what the catalog tells movies apart by: the TMDb ID, or for
+// movies without one the title and director. Movies without a director can
+// share a key.
+type movieKey struct {
+	tmdbID     int
+	title      string
+	directorID int
+}
+
+func keyOfMovie(m Movie) movieKey {
+	if m.TMDbID != 0 {
+		return movieKey{tmdbID: m.TMDbID}
+	}
+	return movieKey{title: m.Title, directorID: m.DirectorID}
+}
+
+// restoreCatalog adds the archive's contents to the catalog as one journaled
+// change. People are matched by TMDb ID or by exact name and birth year,
+// movies by TMDb ID or by title and director, so restoring into a non-empty
+// catalog merges instead of duplicating. Matches in the trash are taken out
+// of it.
+func restoreCatalog(store MovieStore, archive *catalogArchive) error {
+	var peopleAdded, moviesAdded, moviesMerged, linksAdded int
+
+	err := journaled(store, "restore archive", func(tx MovieStore, c *journalChange) error {
+		// Into an empty catalog every archived person is inserted as they
+		// are, namesakes included; otherwise only exact matches merge
+		catalogPeople, err := tx.People()
+		if err != nil {
+			return err
+		}
+		trashedPeople, err := tx.TrashedPeople()
+		if err != nil {
+			return err
+		}
+		catalogPeople = append(catalogPeople, trashedPeople...)
+		taken := map[int]bool{}
+
+		// Archive ID -> catalog ID
+		personIDs := map[int]int{}
+		for _, p := range archive.People {
+			if _, dup := personIDs[p.ID]; dup {
+				return fmt.Errorf("%w: person ID %d appears twice", errBadArchive, p.ID)
+			}
+			person := Person{Name: p.Name, TMDbID: p.TMDbID}
+			if p.BirthYear != nil {
+				person.BirthYear = *p.BirthYear
+			}
+			if person.BirthDate, err = archiveDate(p.BirthDate); err != nil {
+				return fmt.Errorf("%w: person '%s' has %v", errBadArchive, p.Name, err)
+			}
+			if person.DeathDate, err = archiveDate(p.DeathDate); err != nil {
+				return fmt.Errorf("%w: person '%s' has %v", errBadArchive, p.Name, err)
+			}
+
+			if match := restoredPerson(catalogPeople, person, taken); match != nil {
+				taken[match.ID] = true
+				personIDs[p.ID] = match.ID
+				if !match.TrashedAt.IsZero() {
+					if err := c.touchPeople(match.ID); err != nil {
+						return err
+					}
+					if err := tx.RestorePerson(match.ID); err != nil {
+						return fmt.Errorf("restoring person '%s' from the trash: %w", p.Name, err)
+					}
+				}
+				continue
+			}
+			id, err := tx.InsertPerson(person)
+			if err != nil {
+				return fmt.Errorf("restoring person '%s': %w", p.Name, err)
+			}
+			c.addedPerson(id)
+			peopleAdded++
+			personIDs[p.ID] = id
+		}
+
+		catalogMovies, err := tx.Movies()
+		if err != nil {
+			return err
+		}
+		trashedMovies, err := tx.TrashedMovies()
+		if err != nil {
+			return err
+		}
+		// Each catalog movie stands for at most one archived movie, those
+		// outside the trash first
+		movieByKey := map[movieKey][]Movie{}
+		for _, m := range append(catalogMovies, trashedMovies...) {
+			key := keyOfMovie(m)
+			movieByKey[key] = append(movieByKey[key], m)
+		}
+
+		movieIDs := map[int]int{}
+		for _, m := range archive.Movies {
+			// Director ID 0 is a movie whose director was deleted
+			directorID, ok := personIDs[m.DirectorID]
+			if !ok && m.DirectorID != 0 {
+				return fmt.Errorf("%w: movie '%s' has unknown director ID %d", errBadArchive, m.Title, m.DirectorID)
+			}
+
+			released, err := archiveDate(m.ReleaseDate)
+			if err != nil {
+				return fmt.Errorf("%w: movie '%s' has %v", errBadArchive, m.Title, err)
+			}
+			movie := Movie{
+				Title:         m.Title,
+				DirectorID:    directorID,
+				ReleaseYear:   m.ReleaseYear,
+				ReleaseDate:   released,
+				LengthMinutes: m.LengthMinutes,
+				TMDbID:        m.TMDbID,
+			}
+
+			// Keep the catalog's movie rather than insert a duplicate
+			var id int
+			if matches := movieByKey[keyOfMovie(movie)]; len(matches) > 0 {
+				id = matches[0].ID
+				movieByKey[keyOfMovie(movie)] = matches[1:]
+				moviesMerged++
+				if err := c.touchMovies(id); err != nil {
+					return err
+				}
+				if !matches[0].TrashedAt.IsZero() {
+					if err := tx.RestoreMovie(id); err != nil {
+						return fmt.Errorf("restoring movie '%s' from the trash: %w", m.Title, err)
+					}
+				}
+			} else {
+				if id, err = tx.AddMovie(movie); err != nil {
+					return fmt.Errorf("restoring movie '%s': %w", m.Title, err)
+				}
+				moviesAdded++
+				c.addedMovie(id)
+			}
+			movieIDs[m.ID] = id
+
+			if err := linkGenres(tx, id, m.Genres); err != nil {
+				return fmt.Errorf("restoring movie '%s': %w", m.Title, err)
+			}
+		}
+
+		for _, link := range archive.MovieActors {
+			movieID, ok := movieIDs[link.MovieID]
+			if !ok {
+				return fmt.Errorf("%w: cast link to unknown movie ID %d", errBadArchive, link.MovieID)
+			}
+			actorID, ok := personIDs[link.ActorID]
+			if !ok {
+				return fmt.Errorf("%w: cast link to unknown person ID %d", errBadArchive, link.ActorID)
+			}
+			if err := tx.LinkActor(CastLink{MovieID: movieID, ActorID: actorID, Character: link.Character, Order: link.Order}); err != nil {
+				return fmt.Errorf("restoring cast link: %w", err)
+			}
+			linksAdded++
+		}
+
+		for _, c := range archive.Credits {
+			movieID, ok := movieIDs[c.MovieID]
+			if !ok {
+				return fmt.Errorf("%w: crew credit on unknown movie ID %d", errBadArchive, c.MovieID)
+			}
+			personID, ok := personIDs[c.PersonID]
+			if !ok {
+				return fmt.Errorf("%w: crew credit for unknown person ID %d", errBadArchive, c.PersonID)
+			}
+			if err := tx.AddCredit(movieID, personID, c.Job); err != nil {
+				return fmt.Errorf("restoring crew credit: %w", err)
+			}
+		}
+
+		current := tx.CurrentUser()
+		defer tx.SwitchUser(current)
+		for _, user := range archive.Users {
+			name := user.Name
+			if name == "" {
+				name = current
+			}
+			if _, err := tx.SwitchUser(name); err != nil {
+				return fmt.Errorf("restoring user %s: %w", name, err)
+			}
+			if err := restoreUser(tx, user, movieIDs); err != nil {
+				return fmt.Errorf("restoring data of user %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("restore aborted, the catalog is unchanged: %w", err)
+	}
+
+	fmt.Printf("Restored %d people, %d movies and %d cast links", peopleAdded, moviesAdded, linksAdded)
+	if merged := len(archive.People) - peopleAdded; merged > 0 || moviesMerged > 0 {
+		fmt.Printf(" (%d people and %d movies were already in the catalog)", merged, moviesMerged)
+	}
+	fmt.Println(".")
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newEmptyStoreLike returns an empty catalog on the same backend as store.
+func newEmptyStoreLike(t *testing.T, store MovieStore) MovieStore {
+	if _, ok := store.(*sqlStore); ok {
+		return newTestSQLiteStore(t)
+	}
+	return newMemoryStore()
+}
+
+// catalogContents describes a catalog by names rather than IDs, so catalogs
+// with the same contents compare equal.
+func catalogContents(t *testing.T, store MovieStore) []string {
+	t.Helper()
+	archive, err := exportCatalog(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[int]string{}
+	var contents []string
+	for _, p := range archive.People {
+		birthYear := "?"
+		if p.BirthYear != nil {
+			birthYear = fmt.Sprint(*p.BirthYear)
+		}
+		names[p.ID] = fmt.Sprintf("%s (%s, TMDb %d)", p.Name, birthYear, p.TMDbID)
+		contents = append(contents, fmt.Sprintf("person %s, born %q, died %q", names[p.ID], p.BirthDate, p.DeathDate))
+	}
+	titles := map[int]string{}
+	for _, m := range archive.Movies {
+		titles[m.ID] = fmt.Sprintf("%s (TMDb %d)", m.Title, m.TMDbID)
+		contents = append(contents, fmt.Sprintf("movie %s by %s, %d, %d min, %v", titles[m.ID], names[m.DirectorID], m.ReleaseYear, m.LengthMinutes, m.Genres))
+	}
+	for _, link := range archive.MovieActors {
+		contents = append(contents, fmt.Sprintf("cast %s as %s (#%d) in %s", names[link.ActorID], link.Character, link.Order, titles[link.MovieID]))
+	}
+	for _, user := range archive.Users {
+		contents = append(contents, "user "+user.Name)
+		for _, m := range user.Movies {
+			if r := m.Rating; r != nil {
+				contents = append(contents, fmt.Sprintf("rating by %s of %s: %d/10, %q, %s", user.Name, titles[m.MovieID], r.Score, r.Review, r.RatedAt.Format(time.RFC3339)))
+			}
+			if n := m.Note; n != nil {
+				contents = append(contents, fmt.Sprintf("note by %s on %s: %q, %s", user.Name, titles[m.MovieID], n.Text, n.UpdatedAt.Format(time.RFC3339)))
+			}
+		}
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		director, _, err := store.AddPerson(Person{Name: "Ridley Scott", BirthYear: 1937, BirthDate: time.Date(1937, 11, 30, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		actor := mustAddPerson(t, store, "Sigourney Weaver", 0)
+		for _, m := range []Movie{
+			{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117},
+			{Title: "Blade Runner", DirectorID: director, ReleaseYear: 1982, LengthMinutes: 117},
+		} {
+			id, err := store.AddMovie(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Title == "Alien" {
+				if err := store.LinkActor(CastLink{MovieID: id, ActorID: actor, Character: "Ripley", Order: 1}); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.RateMovie(id, Rating{Score: 9, Review: "In space no one can hear you scream.", RatedAt: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.SetNote(id, "Watch the director's cut next", time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.LinkGenre(id, "Sci-Fi"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := catalogContents(t, store)
+
+		archive, err := exportCatalog(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "catalog.json.gz")
+		if err := writeArchive(path, archive, true); err != nil {
+			t.Fatal(err)
+		}
+		if archive, err = readArchive(path); err != nil {
+			t.Fatal(err)
+		}
+
+		restored := newEmptyStoreLike(t, store)
+		if _, err := restored.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := restoreCatalog(restored, archive); err != nil {
+			t.Fatal(err)
+		}
+		if got := catalogContents(t, restored); !reflect.DeepEqual(got, want) {
+			t.Errorf("restored catalog:\n%q\nwant:\n%q", got, want)
+		}
+
+		// Restoring into a catalog that has the same contents changes nothing
+		if err := restoreCatalog(restored, archive); err != nil {
+			t.Fatal(err)
+		}
+		if got := catalogContents(t, restored); !reflect.DeepEqual(got, want) {
+			t.Errorf("catalog after restoring twice:\n%q\nwant:\n%q", got, want)
+		}
+	})
+}
+
+func TestRestoreNamesakes(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		restored := newEmptyStoreLike(t, store)
+		merged := newEmptyStoreLike(t, store)
+		for _, s := range []MovieStore{store, restored, merged} {
+			if _, err := s.SwitchUser("alice"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		namesakes := []Person{
+			{Name: "John Smith"},
+			{Name: "John Smith"},
+			{Name: "John Smith", BirthYear: 1950},
+			{Name: "John Smith", BirthYear: 1950, TMDbID: 42},
+		}
+		for i, p := range namesakes {
+			id, err := store.InsertPerson(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.AddMovie(Movie{Title: fmt.Sprintf("Part %d", i+1), DirectorID: id, ReleaseYear: 2000 + i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := catalogContents(t, store)
+		archive, err := exportCatalog(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// An empty catalog gets every namesake, and restoring again merges
+		// each of them with itself
+		for i := 0; i < 2; i++ {
+			if err := restoreCatalog(restored, archive); err != nil {
+				t.Fatal(err)
+			}
+			if got := catalogContents(t, restored); !reflect.DeepEqual(got, want) {
+				t.Errorf("catalog after restoring %d times:\n%q\nwant:\n%q", i+1, got, want)
+			}
+		}
+
+		// An unknown birth year only matches an unknown birth year, and a
+		// TMDb ID only the same TMDb ID
+		mustAddPerson(t, merged, "John Smith", 1950)
+		if err := restoreCatalog(merged, archive); err != nil {
+			t.Fatal(err)
+		}
+		if got := catalogContents(t, merged); !reflect.DeepEqual(got, want) {
+			t.Errorf("catalog after restoring into one with a namesake:\n%q\nwant:\n%q", got, want)
+		}
+	})
+}
+
+func TestRestoreBadArchive(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		archive := &catalogArchive{
+			Format:  archiveFormat,
+			Version: archiveVersion,
+			People:  []archivePerson{{ID: 1, Name: "Ridley Scott"}},
+			Movies:  []archiveMovie{{ID: 1, Title: "Alien", DirectorID: 2, ReleaseYear: 1979}},
+		}
+		if err := restoreCatalog(store, archive); !errors.Is(err, errBadArchive) {
+			t.Errorf("restoreCatalog with an unknown director: err = %v; want errBadArchive", err)
+		}
+		if _, err := personByName(store, "Ridley Scott"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("PersonByName after a failed restore: err = %v; want ErrNotFound", err)
+		}
+	})
+}
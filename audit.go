@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const logUsage = "usage: log [-p | -m] [-since YYYY-MM-DD] [-until YYYY-MM-DD] [regex]"
+
+// auditedPerson is how the audit log shows a person: as exported, and when
+// they went to the trash.
+type auditedPerson struct {
+	archivePerson
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
+}
+
+// auditedMovie is how the audit log shows a movie: as exported, with its
+// cast and crew and when it went to the trash.
+type auditedMovie struct {
+	archiveMovie
+	Cast      []archiveCasting `json:"cast,omitempty"`
+	Crew      []archiveCredit  `json:"crew,omitempty"`
+	TrashedAt *time.Time       `json:"trashed_at,omitempty"`
+}
+
+// auditChange logs an entry for each person and movie the change inserted,
+// updated, deleted, trashed or restored. Records it touched but left as they
+// were are skipped.
+func auditChange(tx MovieStore, summary string, before, after journalState) error {
+	entry := AuditEntry{User: tx.CurrentUser(), Summary: summary, RecordedAt: time.Now().UTC()}
+
+	people := func(state journalState) map[int]Person {
+		byID := map[int]Person{}
+		for _, p := range state.People {
+			byID[p.ID] = p
+		}
+		return byID
+	}
+	oldPeople, newPeople := people(before), people(after)
+	entry.Entity = "person"
+	for _, id := range after.PeopleIDs {
+		var old, new interface{}
+		entry.EntityID = id
+		p, existed := oldPeople[id]
+		if existed {
+			old, entry.EntityName = toAuditedPerson(p), p.Name
+		}
+		q, exists := newPeople[id]
+		if exists {
+			new, entry.EntityName = toAuditedPerson(q), q.Name
+		}
+		entry.Operation = ""
+		if existed && exists {
+			entry.Operation = trashOperation(p.TrashedAt, q.TrashedAt)
+		}
+		if err := recordAudit(tx, entry, old, new); err != nil {
+			return err
+		}
+	}
+
+	movies := func(state journalState) map[int]movieState {
+		byID := map[int]movieState{}
+		for _, m := range state.Movies {
+			byID[m.Movie.ID] = m
+		}
+		return byID
+	}
+	oldMovies, newMovies := movies(before), movies(after)
+	entry.Entity = "movie"
+	for _, id := range after.MovieIDs {
+		var old, new interface{}
+		entry.EntityID = id
+		m, existed := oldMovies[id]
+		if existed {
+			old, entry.EntityName = toAuditedMovie(m), m.Movie.Title
+		}
+		n, exists := newMovies[id]
+		if exists {
+			new, entry.EntityName = toAuditedMovie(n), n.Movie.Title
+		}
+		entry.Operation = ""
+		if existed && exists {
+			entry.Operation = trashOperation(m.Movie.TrashedAt, n.Movie.TrashedAt)
+		}
+		if err := recordAudit(tx, entry, old, new); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashOperation names the operation that moved a record into or out of the
+// trash, or returns "" if it stayed where it was.
+func trashOperation(before, after time.Time) string {
+	switch {
+	case before.IsZero() && !after.IsZero():
+		return "trash"
+	case !before.IsZero() && after.IsZero():
+		return "restore"
+	}
+	return ""
+}
+
+// trashTime is the TrashedAt of an audited record: nil unless in the trash.
+func trashTime(at time.Time) *time.Time {
+	if at.IsZero() {
+		return nil
+	}
+	return &at
+}
+
+func toAuditedPerson(p Person) auditedPerson {
+	return auditedPerson{archivePerson: toArchivePerson(p), TrashedAt: trashTime(p.TrashedAt)}
+}
+
+func toAuditedMovie(m movieState) auditedMovie {
+	audited := auditedMovie{archiveMovie: toArchiveMovie(m.Movie, m.Genres), TrashedAt: trashTime(m.Movie.TrashedAt)}
+	for _, link := range m.Cast {
+		audited.Cast = append(audited.Cast, archiveCasting{MovieID: link.MovieID, ActorID: link.ActorID, Character: link.Character, Order: link.Order})
+	}
+	for _, c := range m.Credits {
+		audited.Crew = append(audited.Crew, archiveCredit{MovieID: c.MovieID, PersonID: c.PersonID, Job: c.Job})
+	}
+	return audited
+}
+
+// recordAudit logs the entry with the record's JSON on either side, nil where
+// it did not exist, unless nothing changed. The operation follows from the
+// sides unless the entry already names one.
+func recordAudit(tx MovieStore, entry AuditEntry, before, after interface{}) error {
+	encode := func(record interface{}) (string, error) {
+		if record == nil {
+			return "", nil
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return "", fmt.Errorf("encoding audit entry: %w", err)
+		}
+		return string(data), nil
+	}
+
+	var err error
+	if entry.Before, err = encode(before); err != nil {
+		return err
+	}
+	if entry.After, err = encode(after); err != nil {
+		return err
+	}
+	switch {
+	case entry.Before == entry.After:
+		return nil
+	case entry.Operation != "":
+	case entry.Before == "":
+		entry.Operation = "insert"
+	case entry.After == "":
+		entry.Operation = "delete"
+	default:
+		entry.Operation = "update"
+	}
+	if err := tx.RecordAudit(entry); err != nil {
+		return fmt.Errorf("auditing %s: %w", entry.Summary, err)
+	}
+	return nil
+}
+
+// auditLogCommand implements `log`: it prints the audit entries for people
+// (-p) or movies (-m) whose name matches the regex, recorded between the
+// days given, both included.
+func auditLogCommand(store MovieStore, args []string) error {
+	fs := newCommandFlagSet("log")
+	people := fs.Bool("p", false, "only changes to people")
+	movies := fs.Bool("m", false, "only changes to movies")
+	since := fs.String("since", "", "only changes on or after this day")
+	until := fs.String("until", "", "only changes on or before this day")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 || *people && *movies {
+		return usageError{logUsage}
+	}
+
+	var filter AuditFilter
+	switch {
+	case *people:
+		filter.Entity = "person"
+	case *movies:
+		filter.Entity = "movie"
+	}
+	if len(rest) == 1 {
+		if filter.Name, err = regexp.Compile(rest[0]); err != nil {
+			return usageError{fmt.Sprintf("invalid regex: %v", err)}
+		}
+	}
+	if *since != "" {
+		if filter.Since, err = parseLogDay(*since); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseLogDay(*until); err != nil {
+			return err
+		}
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+
+	entries, err := store.AuditLog(filter)
+	if err != nil {
+		return fmt.Errorf("reading the audit log: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No changes found.")
+		return nil
+	}
+	printAuditLog(entries)
+	return nil
+}
+
+// parseLogDay parses a YYYY-MM-DD day of the local calendar.
+func parseLogDay(s string) (time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, usageError{fmt.Sprintf("invalid day %q (use YYYY-MM-DD)", s)}
+	}
+	return day, nil
+}
+
+// printAuditLog prints the entries grouped by the change they were part of.
+func printAuditLog(entries []AuditEntry) {
+	for i, e := range entries {
+		if i == 0 || e.Summary != entries[i-1].Summary || e.User != entries[i-1].User || !e.RecordedAt.Equal(entries[i-1].RecordedAt) {
+			fmt.Printf("%s  %s: %s\n", e.RecordedAt.Local().Format("2006-01-02 15:04:05"), e.User, e.Summary)
+		}
+		verb := strings.TrimSuffix(e.Operation, "e") + "ed"
+		fmt.Printf("    %s %s %d '%s'\n", verb, e.Entity, e.EntityID, e.EntityName)
+		if e.Before != "" {
+			fmt.Printf("        before: %s\n", e.Before)
+		}
+		if e.After != "" {
+			fmt.Printf("        after:  %s\n", e.After)
+		}
+	}
+}
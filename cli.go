@@ -0,0 +1,400 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes of one-shot commands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// usageError reports a malformed command line, as opposed to a command that
+// was understood but failed.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+const cliUsage = `usage: movies [flags] [command]
+
+Without a command the interactive console starts. With --script FILE, or
+when stdin is not a terminal, console commands are read from the input
+instead. Commands:
+  list [-v] [-t regex] [-d regex] [-a regex] [-g regex] [--crew job=name]...
+       [--watched|--unwatched] [--min-rating N] [-la|-ld|-ra|-rd] [--format text|json|csv|tsv|yaml]
+  rate [-d director] <title> <score> [review] | rate -u [-d director] <title>
+  watch add|rm|log|list|history ...
+  note [-d director] <title> [text] | note -rm [-d director] <title> | note
+  user [list]                   (pick the profile with --user NAME)
+  person add [-birth-year N | -born YYYY-MM-DD] [-died YYYY-MM-DD] <name>
+  person delete [-reassign NAME | -cascade | -detach] <name>
+                                (the flags say what happens to a director's movies)
+  movie add -title T -length hh:mm -director NAME -year YYYY[-MM-DD] [-actor NAME[=CHARACTER]]... [-genre G]...
+  movie delete [-orphans] <title> [year]
+  undo | redo                   (revert or reapply the last change to people and movies)
+  log [-p | -m] [-since YYYY-MM-DD] [-until YYYY-MM-DD] [regex]
+                                (who changed which people or movies, and how)
+  trash [list] | trash restore|purge -p <name> | -m <title> [year]
+  trash purge -all              (deleted people and movies wait in the trash)
+  import [-format csv|tsv|json] [-map field=column]... [-all-or-nothing] people|movies|cast FILE
+  export [-gzip] FILE
+  restore FILE                  (combine with --reset to replace the catalog)
+  serve
+  config show
+  migrate status|up|down [N]
+
+People who share a name are told apart by birth year, e.g. "John Smith (b. 1970)".`
+
+// runCommand runs a one-shot command given on the command line and returns
+// the process exit code. It never prompts.
+func runCommand(args []string) int {
+	err := dispatchCommand(args)
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintln(os.Stderr, "Run 'movies -h' for usage.")
+		return exitUsage
+	}
+	return exitFailure
+}
+
+func dispatchCommand(args []string) error {
+	switch args[0] {
+	case "config":
+		if len(args) != 2 || args[1] != "show" {
+			return usageError{"usage: config show"}
+		}
+		printConfig(os.Stdout, config)
+		return nil
+
+	case "migrate":
+		// Migrations are managed explicitly here, so skip the startup mode
+		store, err := connectToDB()
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer store.Close()
+		return runMigrateCommand(store, args[1:])
+
+	case "list", "l":
+		opts, err := parseListFlags(args[1:])
+		if err != nil {
+			return usageError{err.Error()}
+		}
+		return withCatalog(func(store MovieStore) error {
+			return runList(store, opts)
+		})
+
+	case "rate", "r":
+		return withCatalog(func(store MovieStore) error {
+			return rateMovie(store, args[1:])
+		})
+
+	case "watch", "w":
+		return withCatalog(func(store MovieStore) error {
+			return watchCommand(store, args[1:])
+		})
+
+	case "note", "n":
+		return withCatalog(func(store MovieStore) error {
+			return noteCommand(store, args[1:])
+		})
+
+	case "user":
+		if len(args) > 1 && args[1] == "switch" {
+			return usageError{"user switch only works in the console; use --user NAME to pick a profile"}
+		}
+		return withCatalog(func(store MovieStore) error {
+			return userCommand(store, args[1:])
+		})
+
+	case "person":
+		return runPersonCommand(args[1:])
+
+	case "movie":
+		return runMovieCommand(args[1:])
+
+	case "undo", "redo":
+		if len(args) != 1 {
+			return usageError{"usage: " + args[0]}
+		}
+		return withCatalog(func(store MovieStore) error {
+			return undoChange(store, args[0] == "redo")
+		})
+
+	case "log":
+		return withCatalog(func(store MovieStore) error {
+			return auditLogCommand(store, args[1:])
+		})
+
+	case "trash":
+		// Restoring from the trash is a subcommand, since restore is taken
+		// by archives
+		sub := args[1:]
+		if len(sub) == 0 {
+			sub = []string{"list"}
+		}
+		return withCatalog(func(store MovieStore) error {
+			return trashCommand(store, nil, sub)
+		})
+
+	case "import":
+		return runImportCommand(args[1:])
+
+	case "export":
+		return runExportCommand(args[1:])
+
+	case "restore":
+		return runRestoreCommand(args[1:])
+
+	case "serve":
+		if len(args) != 1 {
+			return usageError{"usage: serve (set the address with --addr)"}
+		}
+		return withCatalog(func(store MovieStore) error {
+			return serve(store, config.Server.Addr)
+		})
+
+	default:
+		return usageError{fmt.Sprintf("unknown command: %s", args[0])}
+	}
+}
+
+// withCatalog opens the catalog for a one-shot command. Startup progress goes
+// to stderr so stdout only carries the command's own output.
+func withCatalog(fn func(store MovieStore) error) error {
+	store, err := openCatalog(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return fn(store)
+}
+
+func runPersonCommand(args []string) error {
+	if len(args) == 0 {
+		return usageError{"usage: person add|delete ..."}
+	}
+
+	switch args[0] {
+	case "add":
+		fs := newCommandFlagSet("person add")
+		birthYear := fs.Int("birth-year", 0, "year of birth")
+		born := fs.String("born", "", "date of birth as YYYY-MM-DD")
+		died := fs.String("died", "", "date of death as YYYY-MM-DD")
+		names, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(names) != 1 {
+			return usageError{"usage: person add [-birth-year N | -born YYYY-MM-DD] [-died YYYY-MM-DD] <name>"}
+		}
+		person := Person{Name: names[0], BirthYear: *birthYear}
+		if *born != "" {
+			if person.BirthDate, err = parseDate(*born); err != nil {
+				return usageError{err.Error()}
+			}
+			if person.BirthYear == 0 {
+				person.BirthYear = person.BirthDate.Year()
+			}
+		}
+		if *died != "" {
+			if person.DeathDate, err = parseDate(*died); err != nil {
+				return usageError{err.Error()}
+			}
+		}
+		return withCatalog(func(store MovieStore) error {
+			if _, err := createPerson(store, person); err != nil {
+				return err
+			}
+			fmt.Printf("Successfully added person: %s (Birth Year: %d)\n", person.Name, person.BirthYear)
+			return nil
+		})
+
+	case "delete":
+		const usage = "usage: person delete [-reassign NAME | -cascade | -detach] <name>"
+		fs := newCommandFlagSet("person delete")
+		reassign := fs.String("reassign", "", "hand the person's movies to this director")
+		cascade := fs.Bool("cascade", false, "delete the person's movies too")
+		detach := fs.Bool("detach", false, "leave the person's movies without them as director")
+		names, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(names) != 1 {
+			return usageError{usage}
+		}
+		mode := ""
+		for _, option := range []struct {
+			set  bool
+			mode string
+		}{{*reassign != "", reassignMovies}, {*cascade, cascadeMovies}, {*detach, detachMovies}} {
+			if !option.set {
+				continue
+			}
+			if mode != "" {
+				return usageError{usage}
+			}
+			mode = option.mode
+		}
+		return withCatalog(func(store MovieStore) error {
+			person, err := findPersonToDelete(store, names[0])
+			if err != nil {
+				return err
+			}
+			var to *Person
+			if *reassign != "" {
+				if to, err = lookupPerson(store, *reassign); err != nil {
+					_, failure := lookupFailure("director", *reassign, err)
+					return failure
+				}
+			}
+			plan, err := planDirectorDeletion(store, person, mode, to)
+			if errors.Is(err, ErrPersonIsDirector) {
+				return fmt.Errorf("%w; pass -reassign NAME, -cascade or -detach", err)
+			} else if err != nil {
+				return err
+			}
+			movies, err := deleteDirector(store, plan)
+			if err != nil {
+				return err
+			}
+			printDeletedDirector(plan, movies)
+			return nil
+		})
+
+	default:
+		return usageError{fmt.Sprintf("unknown person command: %s", args[0])}
+	}
+}
+
+func runMovieCommand(args []string) error {
+	if len(args) > 0 && args[0] == "delete" {
+		return withCatalog(func(store MovieStore) error {
+			plan, err := parseMovieDeletion(store, "movie delete", "usage: movie delete [-orphans] <title> [year]", args[1:])
+			if err != nil {
+				return err
+			}
+			if err := deleteMovie(store, plan); err != nil {
+				return err
+			}
+			printDeletedMovie(plan)
+			return nil
+		})
+	}
+	if len(args) == 0 || args[0] != "add" {
+		return usageError{"usage: movie add|delete ..."}
+	}
+
+	fs := newCommandFlagSet("movie add")
+	title := fs.String("title", "", "movie title")
+	length := fs.String("length", "", "length as hh:mm")
+	director := fs.String("director", "", "name of an existing director")
+	yearOrDate := fs.String("year", "", "release year or date as YYYY-MM-DD")
+	var actors stringList
+	fs.Var(&actors, "actor", "name of an existing actor, optionally =CHARACTER (repeatable, in billing order)")
+	var genres stringList
+	fs.Var(&genres, "genre", "genre of the movie (repeatable)")
+	rest, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", rest[0])}
+	}
+
+	// Validate the input the same way the interactive prompts do
+	if strings.TrimSpace(*title) == "" {
+		return usageError{"-title is required"}
+	}
+	lengthMinutes, err := parseLength(*length)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	year, released, err := parseYearOrDate(*yearOrDate)
+	if err != nil {
+		return usageError{"-year must be a positive year or a YYYY-MM-DD date"}
+	}
+
+	return withCatalog(func(store MovieStore) error {
+		directorPerson, err := lookupPerson(store, *director)
+		if err != nil {
+			_, failure := lookupFailure("director", *director, err)
+			return failure
+		}
+
+		var cast []CastLink
+		for _, value := range actors {
+			name, character, _ := strings.Cut(value, "=")
+			actor, err := lookupPerson(store, name)
+			if err != nil {
+				_, failure := lookupFailure("actor", name, err)
+				return failure
+			}
+			cast = append(cast, CastLink{ActorID: actor.ID, Character: strings.TrimSpace(character)})
+		}
+
+		_, err = saveNewMovie(store, Movie{
+			Title:         *title,
+			DirectorID:    directorPerson.ID,
+			ReleaseYear:   year,
+			ReleaseDate:   released,
+			LengthMinutes: lengthMinutes,
+		}, cast, genres)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Successfully added movie: %s\n", *title)
+		return nil
+	})
+}
+
+func newCommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, and returns the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usageError{err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the application needs at runtime. Values are
+// resolved in increasing order of precedence: built-in defaults, the config
+// file, environment variables and finally command-line flags.
+type Config struct {
+	Database DatabaseConfig
+	TMDb     TMDbConfig
+	Metadata MetadataConfig
+	Startup  StartupConfig
+	Batch    BatchConfig
+	Server   ServerConfig
+	User     UserConfig
+
+	// File is the config file that was loaded, if any.
+	File string
+
+	// sources records which layer supplied each key, for `config show`.
+	sources map[string]string
+}
+
+type DatabaseConfig struct {
+	// Driver is "postgres", "sqlite" or "memory".
+	Driver string
+	// URL is a connection string for postgres or a file path for sqlite.
+	URL string
+}
+
+type TMDbConfig struct {
+	APIKey  string
+	BaseURL string
+}
+
+// MetadataConfig selects where movie metadata comes from.
+type MetadataConfig struct {
+	// Provider is "tmdb" for the TMDb API or "local" for JSON fixtures.
+	Provider string
+	// LocalDir is the fixture directory used by the local provider.
+	LocalDir string
+}
+
+// StartupConfig selects what happens to the catalog before the console
+// starts.
+type StartupConfig struct {
+	// Reset drops and recreates the schema. It is only ever set by the
+	// --reset flag so a config file can never wipe the database by accident.
+	Reset bool
+	// Seed is one of "none", "tmdb" or "fixture".
+	Seed string
+	// Fixture is the JSON file used when Seed is "fixture".
+	Fixture string
+}
+
+// ServerConfig configures the REST API started by `serve`.
+type ServerConfig struct {
+	Addr string
+}
+
+// UserConfig selects the user profile that owns ratings, notes, the
+// watchlist and the watch history.
+type UserConfig struct {
+	Name string
+}
+
+// BatchConfig controls script mode, which runs console commands from a file
+// or from non-terminal stdin. It is set by flags only.
+type BatchConfig struct {
+	Script          string
+	ContinueOnError bool
+}
+
+// configField describes one setting and where it can be supplied from.
+type configField struct {
+	key    string // dotted key used in config files, e.g. "database.url"
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  *string
+}
+
+const configEnvVar = "MOVIES_CONFIG"
+
+// defaultConfigFiles are looked up in the working directory when neither
+// --config nor MOVIES_CONFIG is given.
+var defaultConfigFiles = []string{"movies.yaml", "movies.yml", "movies.toml"}
+
+func defaultConfig() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Driver: "postgres",
+			URL:    "postgres://postgres@localhost:5432/postgres?sslmode=disable",
+		},
+		TMDb: TMDbConfig{
+			BaseURL: "https://api.themoviedb.org/3",
+		},
+		Metadata: MetadataConfig{
+			Provider: "tmdb",
+		},
+		Startup: StartupConfig{
+			Seed: "none",
+		},
+		Server: ServerConfig{
+			Addr: ":8080",
+		},
+		User: UserConfig{
+			Name: "default",
+		},
+		sources: map[string]string{},
+	}
+}
+
+func (c *Config) fields() []configField {
+	return []configField{
+		{key: "database.driver", env: "MOVIES_DATABASE_DRIVER", flag: "db-driver", usage: "database driver: postgres, sqlite or memory", value: &c.Database.Driver},
+		{key: "database.url", env: "MOVIES_DATABASE_URL", flag: "db", usage: "database connection string, or file path for sqlite", secret: true, value: &c.Database.URL},
+		{key: "tmdb.api_key", env: "MOVIES_TMDB_API_KEY", flag: "tmdb-api-key", usage: "TMDb API key", secret: true, value: &c.TMDb.APIKey},
+		{key: "tmdb.base_url", env: "MOVIES_TMDB_BASE_URL", flag: "tmdb-base-url", usage: "TMDb API base URL", value: &c.TMDb.BaseURL},
+		{key: "metadata.provider", env: "MOVIES_METADATA_PROVIDER", flag: "metadata", usage: "metadata provider: tmdb or local", value: &c.Metadata.Provider},
+		{key: "metadata.local_dir", env: "MOVIES_METADATA_DIR", flag: "metadata-dir", usage: "fixture directory for the local metadata provider", value: &c.Metadata.LocalDir},
+		{key: "startup.seed", env: "MOVIES_SEED", flag: "seed", usage: "seed the catalog on startup: none, tmdb (metadata provider) or fixture", value: &c.Startup.Seed},
+		{key: "startup.fixture", env: "MOVIES_FIXTURE", flag: "fixture", usage: "JSON fixture file used by --seed fixture", value: &c.Startup.Fixture},
+		{key: "server.addr", env: "MOVIES_SERVER_ADDR", flag: "addr", usage: "listen address of the REST API", value: &c.Server.Addr},
+		{key: "user.name", env: "MOVIES_USER", flag: "user", usage: "user profile for ratings, notes and watch tracking", value: &c.User.Name},
+	}
+}
+
+// loadConfig resolves the configuration from defaults, the config file, the
+// environment and the given command-line arguments. It returns the arguments
+// left over after flag parsing.
+func loadConfig(args []string) (*Config, []string, error) {
+	cfg := defaultConfig()
+	fields := cfg.fields()
+
+	// Parse flags first so --config can pick the file, but apply their
+	// values last so they win over every other layer.
+	fs := flag.NewFlagSet("movies", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\n\nFlags:\n", cliUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "path to a YAML or TOML config file")
+	fs.BoolVar(&cfg.Startup.Reset, "reset", false, "drop and recreate the schema before starting")
+	fs.StringVar(&cfg.Batch.Script, "script", "", "run console commands from a file instead of prompting")
+	continueOnError := fs.Bool("continue-on-error", false, "keep running a script after a command fails")
+	stopOnError := fs.Bool("stop-on-error", false, "stop a script at the first failing command (default)")
+	flagValues := map[string]string{}
+	for _, f := range fields {
+		name := f.flag
+		fs.Func(name, f.usage, func(v string) error {
+			flagValues[name] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *continueOnError && *stopOnError {
+		return nil, nil, fmt.Errorf("--continue-on-error and --stop-on-error cannot be used together")
+	}
+	cfg.Batch.ContinueOnError = *continueOnError
+
+	for _, f := range fields {
+		cfg.sources[f.key] = "default"
+	}
+
+	// Config file
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(configEnvVar)
+	}
+	if path == "" {
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		known := map[string]bool{}
+		for _, f := range fields {
+			known[f.key] = true
+			if v, ok := values[f.key]; ok {
+				*f.value = v
+				cfg.sources[f.key] = "file"
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				return nil, nil, fmt.Errorf("%s: unknown config key %q", path, key)
+			}
+		}
+		cfg.File = path
+	}
+
+	// Environment variables
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env); ok {
+			*f.value = v
+			cfg.sources[f.key] = "env"
+		}
+	}
+
+	// Command-line flags
+	for _, f := range fields {
+		if v, ok := flagValues[f.flag]; ok {
+			*f.value = v
+			cfg.sources[f.key] = "flag"
+		}
+	}
+
+	switch cfg.Startup.Seed {
+	case "none", "tmdb":
+	case "fixture":
+		if cfg.Startup.Fixture == "" {
+			return nil, nil, fmt.Errorf("--seed fixture requires a fixture file (--fixture)")
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid seed mode %q (use none, tmdb or fixture)", cfg.Startup.Seed)
+	}
+
+	cfg.User.Name = strings.TrimSpace(cfg.User.Name)
+	if cfg.User.Name == "" {
+		return nil, nil, fmt.Errorf("the user profile name cannot be empty")
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// readConfigFile decodes a YAML or TOML file, chosen by extension, into a flat
+// map of dotted keys.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flattenConfig("", raw, values)
+	return values, nil
+}
+
+func flattenConfig(prefix string, raw map[string]interface{}, out map[string]string) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenConfig(key, nested, out)
+			continue
+		}
+		out[key] = fmt.Sprint(value)
+	}
+}
+
+// printConfig writes the resolved configuration with secrets masked.
+func printConfig(w io.Writer, cfg *Config) {
+	if cfg.File != "" {
+		fmt.Fprintf(w, "# config file: %s\n", cfg.File)
+	} else {
+		fmt.Fprintln(w, "# config file: none")
+	}
+
+	fields := cfg.fields()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	for _, f := range fields {
+		value := *f.value
+		if f.secret {
+			value = maskSecret(value)
+		}
+		fmt.Fprintf(w, "%s = %s (%s)\n", f.key, value, cfg.sources[f.key])
+	}
+}
+
+// maskSecret hides a secret value. Connection URLs keep everything but the
+// password visible; other values keep only their last four characters.
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Redacted()
+	}
+	if len(value) <= 4 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
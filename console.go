@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// console is the single source of input for commands and their prompts. In
+// interactive mode it prints prompts and lets the user retry bad answers; in
+// script mode prompts are silent, answers come from the following script
+// lines and a bad answer fails the command.
+type console struct {
+	reader      *bufio.Reader
+	name        string // shown in error reports, e.g. the script path
+	line        int    // number of the line read last
+	interactive bool
+}
+
+func newConsole(r io.Reader, name string, interactive bool) *console {
+	return &console{reader: bufio.NewReader(r), name: name, interactive: interactive}
+}
+
+// readLine returns the next line without its trailing newline. It returns
+// io.EOF once the input is exhausted.
+func (c *console) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	} else if err != nil && err != io.EOF {
+		return "", err
+	}
+	c.line++
+	return strings.TrimSpace(line), nil
+}
+
+// prompt asks for one answer. The label is only shown interactively.
+func (c *console) prompt(label string) (string, error) {
+	if c.interactive {
+		fmt.Print(label)
+	}
+	answer, err := c.readLine()
+	if err == io.EOF {
+		return "", fmt.Errorf("input ended while waiting for %q", strings.TrimSpace(label))
+	}
+	return answer, err
+}
+
+// promptDefault asks for an answer that defaults to current, which is shown
+// in brackets: an empty answer keeps it.
+func (c *console) promptDefault(label, current string) (string, error) {
+	if current != "" {
+		label += " [" + current + "]"
+	}
+	answer, err := c.prompt(label + ": ")
+	if answer == "" {
+		return current, err
+	}
+	return answer, err
+}
+
+// retry reports a bad answer. Interactively the message is shown, the caller
+// should ask again and retry returns nil; in a script the answer is final and
+// err is returned instead.
+func (c *console) retry(message string, err error) error {
+	if c.interactive {
+		fmt.Println(message)
+		return nil
+	}
+	return err
+}
+
+// stdinIsTerminal reports whether stdin is attached to a terminal rather than
+// a pipe or a file.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// runREPL runs the interactive `> ` loop until exit or end of input.
+func runREPL(store MovieStore, in *console) {
+	fmt.Println("Welcome to the Movie Console Application!")
+
+	for {
+		fmt.Print("> ")
+		input, err := in.readLine()
+		if err != nil {
+			fmt.Println()
+			break
+		}
+
+		if input == "exit" {
+			fmt.Println("Goodbye!")
+			break
+		}
+
+		if err := parseCommand(input, store, in); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// runScript executes every command in the input, reporting failures with
+// their line number. Blank lines and lines starting with # are skipped. It
+// returns the number of failed commands.
+func runScript(store MovieStore, in *console, continueOnError bool) int {
+	failures := 0
+	for {
+		input, err := in.readLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", in.name, err)
+			return failures + 1
+		}
+
+		if input == "" || strings.HasPrefix(input, "#") {
+			continue
+		}
+		if input == "exit" {
+			break
+		}
+
+		if err := parseCommand(input, store, in); err != nil {
+			// in.line points at the failing answer if a prompt consumed lines
+			failures++
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", in.name, in.line, err)
+			if !continueOnError {
+				break
+			}
+		}
+	}
+	return failures
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const deleteMovieUsage = "usage: d -m [-orphans] <title> [year]"
+
+// movieDeletion is what deleting a movie removes.
+type movieDeletion struct {
+	movie *MovieListing
+	// orphans are the people in no other movie, trashed along with it if
+	// asked for
+	orphans []Person
+}
+
+// deleteMovieCommand implements `d -m`. It previews the movie, its cast and
+// the people that would go with it, and moves them to the trash once
+// confirmed.
+func deleteMovieCommand(store MovieStore, in *console, args []string) error {
+	plan, err := parseMovieDeletion(store, "d -m", deleteMovieUsage, args)
+	if err != nil {
+		return err
+	}
+
+	labels, err := loadPersonLabels(store)
+	if err != nil {
+		return err
+	}
+	fmt.Println(formatMovieLine(*plan.movie, labels))
+	fmt.Println("    Starring:")
+	if err := displayActorsForMovie(store, plan.movie.ID, nil, labels); err != nil {
+		return err
+	}
+	if len(plan.orphans) > 0 {
+		fmt.Println("    Left without movies and trashed too:")
+		for _, p := range plan.orphans {
+			fmt.Printf("        - %s\n", labels.name(p.ID, p.Name))
+		}
+	}
+
+	confirmed, err := confirm(in, "Delete this movie?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		fmt.Println("Nothing was deleted.")
+		return nil
+	}
+	if err := deleteMovie(store, plan); err != nil {
+		return err
+	}
+	printDeletedMovie(plan)
+	return nil
+}
+
+// parseMovieDeletion parses the [-orphans] <title> [year] arguments of a
+// delete command and looks up what it would remove.
+func parseMovieDeletion(store MovieStore, name, usage string, args []string) (*movieDeletion, error) {
+	fs := newCommandFlagSet(name)
+	orphans := fs.Bool("orphans", false, "also delete the people left without any movies")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 || len(rest) > 2 {
+		return nil, usageError{usage}
+	}
+	year := 0
+	if len(rest) == 2 {
+		if year, err = parseImportYear(rest[1]); err != nil {
+			return nil, usageError{fmt.Sprintf("invalid release year: %v", err)}
+		}
+	}
+
+	movie, err := findMovieReleased(store, rest[0], year)
+	if err != nil {
+		return nil, err
+	}
+	plan := &movieDeletion{movie: movie}
+	if *orphans {
+		if plan.orphans, err = movieOrphans(store, movie.ID); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// movieOrphans lists the people whose only movie is movieID: its directors,
+// crew and cast who appear nowhere else.
+func movieOrphans(store MovieStore, movieID int) ([]Person, error) {
+	credits, err := store.MovieCredits(movieID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching crew for movie: %w", err)
+	}
+	cast, err := store.MovieCast(movieID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching actors for movie: %w", err)
+	}
+	var ids []int
+	for _, c := range credits {
+		ids = append(ids, c.PersonID)
+	}
+	for _, c := range cast {
+		ids = append(ids, c.PersonID)
+	}
+
+	var orphans []Person
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		movies, err := store.PersonMovieIDs(id)
+		if err != nil {
+			return nil, fmt.Errorf("fetching movies of person %d: %w", id, err)
+		}
+		if len(movies) == 1 && movies[0] == movieID {
+			person, err := store.PersonByID(id)
+			if err != nil {
+				return nil, err
+			}
+			orphans = append(orphans, *person)
+		}
+	}
+	return orphans, nil
+}
+
+// deleteMovie moves the planned movie and people to the trash in one
+// journaled transaction.
+func deleteMovie(store MovieStore, plan *movieDeletion) error {
+	summary := fmt.Sprintf("delete movie '%s' (%d)", plan.movie.Title, plan.movie.ReleaseYear)
+	return journaled(store, summary, func(tx MovieStore, c *journalChange) error {
+		if err := c.touchMovies(plan.movie.ID); err != nil {
+			return err
+		}
+		for _, p := range plan.orphans {
+			if err := c.touchPeople(p.ID); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if err := tx.TrashMovie(plan.movie.ID, now); err != nil {
+			return fmt.Errorf("moving movie '%s' to the trash: %w", plan.movie.Title, err)
+		}
+		for _, p := range plan.orphans {
+			if err := tx.TrashPerson(p.ID, now); err != nil {
+				return fmt.Errorf("moving person '%s' to the trash: %w", p.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func printDeletedMovie(plan *movieDeletion) {
+	fmt.Printf("Moved '%s' (%d) to the trash.\n", plan.movie.Title, plan.movie.ReleaseYear)
+	if len(plan.orphans) > 0 {
+		names := make([]string, 0, len(plan.orphans))
+		for _, p := range plan.orphans {
+			names = append(names, p.Name)
+		}
+		fmt.Printf("Also moved the people left without movies to the trash: %s.\n", joinNames(names))
+	}
+}
+
+// confirm asks a yes/no question; anything but yes means no.
+func confirm(in *console, question string) (bool, error) {
+	answer, err := in.prompt(question + " [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// What happens to a deleted director's movies. The names double as the
+// values of the REST API's `movies` parameter.
+const (
+	reassignMovies = "reassign" // hand them to another director
+	cascadeMovies  = "cascade"  // move them to the trash too
+	detachMovies   = "detach"   // leave them without this director
+)
+
+// directorDeletion is what deleting a director does to their movies.
+type directorDeletion struct {
+	person *Person
+	movies []MovieListing // the movies they direct or co-direct
+	mode   string
+	to     *Person // the new director when reassigning
+}
+
+// moviesDirectedBy lists the movies the person directs or co-directs.
+func moviesDirectedBy(store MovieStore, personID int) ([]MovieListing, error) {
+	ids, err := store.PersonMovieIDs(personID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching movies of person %d: %w", personID, err)
+	}
+	var movies []MovieListing
+	for _, id := range ids {
+		movie, err := store.MovieByID(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range movie.Directors {
+			if d.ID == personID {
+				movies = append(movies, *movie)
+				break
+			}
+		}
+	}
+	return movies, nil
+}
+
+// planDirectorDeletion checks that the mode fits the person and looks up
+// the movies it applies to. A person who directs nothing needs no mode.
+func planDirectorDeletion(store MovieStore, person *Person, mode string, to *Person) (*directorDeletion, error) {
+	plan := &directorDeletion{person: person, mode: mode, to: to}
+	var err error
+	if plan.movies, err = moviesDirectedBy(store, person.ID); err != nil {
+		return nil, err
+	}
+	switch {
+	case mode == "" && len(plan.movies) > 0:
+		return nil, fmt.Errorf("cannot delete '%s': %w", person.Name, ErrPersonIsDirector)
+	case mode == reassignMovies && to == nil:
+		return nil, fmt.Errorf("no director to reassign the movies of '%s' to", person.Name)
+	case mode == reassignMovies && to.ID == person.ID:
+		return nil, fmt.Errorf("cannot reassign the movies of '%s' to themselves", person.Name)
+	}
+	return plan, nil
+}
+
+// printDirectorDeletion previews what deleting the director does to each of
+// their movies.
+func printDirectorDeletion(plan *directorDeletion, labels personLabels) {
+	if len(plan.movies) == 0 {
+		return
+	}
+	fmt.Printf("After deleting '%s':\n", labels.name(plan.person.ID, plan.person.Name))
+	for _, m := range plan.movies {
+		var others []string
+		for _, d := range m.Directors {
+			if d.ID != plan.person.ID {
+				others = append(others, labels.name(d.ID, d.Name))
+			}
+		}
+
+		outcome := "moved to the trash"
+		switch plan.mode {
+		case reassignMovies:
+			outcome = "directed by " + joinNames(append(others, labels.name(plan.to.ID, plan.to.Name))) + " instead"
+		case detachMovies:
+			outcome = "left without a director"
+			if len(others) > 0 {
+				outcome = "still directed by " + joinNames(others)
+			}
+		}
+		fmt.Printf("    - %s (%d): %s\n", m.Title, m.ReleaseYear, outcome)
+	}
+}
+
+// deleteDirector deletes the person and deals with their movies as planned,
+// in one journaled transaction. It returns the movies they were removed from
+// as an actor.
+func deleteDirector(store MovieStore, plan *directorDeletion) ([]Movie, error) {
+	var movies []Movie
+	err := journaled(store, fmt.Sprintf("delete person '%s'", plan.person.Name), func(tx MovieStore, c *journalChange) error {
+		// Every movie they are in loses them, not just those they direct
+		movieIDs, err := tx.PersonMovieIDs(plan.person.ID)
+		if err != nil {
+			return fmt.Errorf("fetching movies of person %d: %w", plan.person.ID, err)
+		}
+		if err := c.touchPeople(plan.person.ID); err != nil {
+			return err
+		}
+		if err := c.touchMovies(movieIDs...); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		switch plan.mode {
+		case reassignMovies:
+			if err := tx.ReassignDirector(plan.person.ID, plan.to.ID); err != nil {
+				return fmt.Errorf("reassigning movies to '%s': %w", plan.to.Name, err)
+			}
+		case detachMovies:
+			if err := tx.ReassignDirector(plan.person.ID, 0); err != nil {
+				return fmt.Errorf("detaching movies from '%s': %w", plan.person.Name, err)
+			}
+		case cascadeMovies:
+			for _, m := range plan.movies {
+				if err := tx.TrashMovie(m.ID, now); err != nil {
+					return fmt.Errorf("moving movie '%s' to the trash: %w", m.Title, err)
+				}
+			}
+		}
+
+		movies, err = deletePersonRecord(tx, plan.person, now)
+		return err
+	})
+	return movies, err
+}
+
+func printDeletedDirector(plan *directorDeletion, movies []Movie) {
+	printDeletedPerson(plan.person.Name, movies)
+	if len(plan.movies) == 0 {
+		return
+	}
+	switch plan.mode {
+	case reassignMovies:
+		fmt.Printf("Their %d movie(s) are now directed by %s.\n", len(plan.movies), plan.to.Name)
+	case cascadeMovies:
+		fmt.Printf("Their %d movie(s) were moved to the trash too.\n", len(plan.movies))
+	case detachMovies:
+		fmt.Printf("Their %d movie(s) no longer list them as director.\n", len(plan.movies))
+	}
+}
+
+// chooseDirectorDeletion lists the person's movies and asks what to do with
+// them. It returns nil if the user cancels.
+func chooseDirectorDeletion(store MovieStore, in *console, person *Person, labels personLabels) (*directorDeletion, error) {
+	movies, err := moviesDirectedBy(store, person.ID)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("'%s' directs %d movie(s):\n", labels.name(person.ID, person.Name), len(movies))
+	for _, m := range movies {
+		fmt.Println("    " + formatMovieLine(m, labels))
+	}
+
+	var mode string
+	for mode == "" {
+		answer, err := in.prompt("Reassign them to another director (r), delete them too (d) or leave them without this director (l)? Press Enter to cancel: ")
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return nil, nil
+		case "r":
+			mode = reassignMovies
+		case "d":
+			mode = cascadeMovies
+		case "l":
+			mode = detachMovies
+		default:
+			if err := in.retry("- Answer r, d or l, try again!", fmt.Errorf("bad choice %q", answer)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var to *Person
+	for mode == reassignMovies && to == nil {
+		name, err := in.prompt("Enter the name of the new director: ")
+		if err != nil {
+			return nil, err
+		}
+		if to, err = lookupPerson(store, name); err != nil {
+			if err := in.retry(lookupFailure("director", name, err)); err != nil {
+				return nil, err
+			}
+		} else if to.ID == person.ID {
+			to = nil
+			if err := in.retry("- Pick someone other than the person being deleted, try again!", fmt.Errorf("cannot reassign the movies of '%s' to themselves", person.Name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return planDirectorDeletion(store, person, mode, to)
+}
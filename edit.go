@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clearAnswer clears an optional value when editing.
+const clearAnswer = "-"
+
+// editMovie implements `e -m`. It asks for the movie, then for each field
+// with the current value as the default, and finally for changes to the
+// cast.
+func editMovie(store MovieStore, in *console) error {
+	title, err := in.prompt("Enter the title of the movie to edit: ")
+	if err != nil {
+		return err
+	}
+	listing, err := findMovie(store, title, "")
+	if errors.Is(err, ErrAmbiguousTitle) {
+		var director string
+		if director, err = in.prompt("Directed by: "); err != nil {
+			return err
+		}
+		listing, err = findMovie(store, title, director)
+	}
+	if err != nil {
+		return err
+	}
+	labels, err := loadPersonLabels(store)
+	if err != nil {
+		return err
+	}
+
+	movie := Movie{
+		ID:            listing.ID,
+		Title:         listing.Title,
+		DirectorID:    listing.DirectorID,
+		ReleaseYear:   listing.ReleaseYear,
+		ReleaseDate:   listing.ReleaseDate,
+		LengthMinutes: listing.LengthMinutes,
+	}
+	if movie.Title, err = in.promptDefault("Title", movie.Title); err != nil {
+		return err
+	}
+
+	// Input length in hh:mm format
+	for {
+		length, err := in.promptDefault("Length", fmt.Sprintf("%02d:%02d", movie.LengthMinutes/60, movie.LengthMinutes%60))
+		if err != nil {
+			return err
+		}
+		minutes, err := parseLength(length)
+		if err != nil {
+			if err := in.retry("- Bad input format (hh:mm), try again!", err); err != nil {
+				return err
+			}
+		} else {
+			movie.LengthMinutes = minutes
+			break
+		}
+	}
+
+	// Input director and validate existence
+	for {
+		director, err := in.promptDefault("Director", labels.name(listing.DirectorID, listing.Director))
+		if err != nil {
+			return err
+		}
+		if director == "" && listing.DirectorID == 0 {
+			// Keep a movie whose director was deleted without one
+			break
+		}
+		person, err := lookupPerson(store, director)
+		if err != nil {
+			if err := in.retry(lookupFailure("director", director, err)); err != nil {
+				return err
+			}
+		} else {
+			movie.DirectorID = person.ID
+			break
+		}
+	}
+
+	// Input release year or date
+	released := movie.ReleaseDate.Format("2006-01-02")
+	if movie.ReleaseDate.IsZero() {
+		released = fmt.Sprint(movie.ReleaseYear)
+	}
+	for {
+		input, err := in.promptDefault("Released in", released)
+		if err != nil {
+			return err
+		}
+		year, date, err := parseYearOrDate(input)
+		if err != nil {
+			if err := in.retry("- Bad release year (YYYY or YYYY-MM-DD), try again!", fmt.Errorf("invalid release year %q", input)); err != nil {
+				return err
+			}
+		} else {
+			movie.ReleaseYear, movie.ReleaseDate = year, date
+			break
+		}
+	}
+
+	err = journaled(store, fmt.Sprintf("edit movie '%s'", listing.Title), func(tx MovieStore, c *journalChange) error {
+		if err := c.touchMovies(movie.ID); err != nil {
+			return err
+		}
+		return tx.UpdateMovie(movie)
+	})
+	if err != nil {
+		return fmt.Errorf("updating movie: %w", err)
+	}
+	if err := editCast(store, in, movie, labels); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully updated movie: %s\n", movie.Title)
+	return nil
+}
+
+// editCast changes a movie's cast one actor at a time: "+ NAME" adds an
+// actor, or recasts one already in the cast, "- NAME" removes one and "exit"
+// finishes. New actors are billed after the others. Each change is journaled
+// on its own.
+func editCast(store MovieStore, in *console, movie Movie, labels personLabels) error {
+	movieID := movie.ID
+	cast, err := store.MovieCast(movieID, nil)
+	if err != nil {
+		return fmt.Errorf("fetching actors for movie: %w", err)
+	}
+	if in.interactive {
+		fmt.Println("Starring:")
+		for _, c := range cast {
+			name := labels.name(c.PersonID, c.Name)
+			if c.Character != "" {
+				name += " as " + c.Character
+			}
+			fmt.Println("    - " + name)
+		}
+		fmt.Println(`Change the cast with "+ NAME" or "- NAME", or enter "exit" when done.`)
+	}
+
+	lastOrder := 0
+	for _, c := range cast {
+		if c.Order > lastOrder {
+			lastOrder = c.Order
+		}
+	}
+
+	for {
+		input, err := in.prompt("> ")
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(input) == "exit" {
+			return nil
+		}
+
+		op, name := "", ""
+		if len(input) > 0 {
+			op, name = input[:1], strings.TrimSpace(input[1:])
+		}
+		if (op != "+" && op != "-") || name == "" {
+			if err := in.retry(`- Use "+ NAME", "- NAME" or "exit", try again!`, fmt.Errorf("bad cast change %q", input)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		person, err := lookupPerson(store, name)
+		if err != nil {
+			if err := in.retry(lookupFailure("actor", name, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if op == "-" {
+			err := journaled(store, fmt.Sprintf("remove '%s' from '%s'", person.Name, movie.Title), func(tx MovieStore, c *journalChange) error {
+				if err := c.touchMovies(movieID); err != nil {
+					return err
+				}
+				return tx.UnlinkActor(movieID, person.ID)
+			})
+			if errors.Is(err, ErrNotFound) {
+				if err := in.retry(fmt.Sprintf("- '%s' is not in the cast, try again!", name), fmt.Errorf("'%s' is not in the cast", name)); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return fmt.Errorf("removing actor: %w", err)
+			}
+			if i := castIndex(cast, person.ID); i >= 0 {
+				cast = append(cast[:i], cast[i+1:]...)
+			}
+			continue
+		}
+
+		link := CastLink{MovieID: movieID, ActorID: person.ID}
+		i := castIndex(cast, person.ID)
+		if i < 0 {
+			lastOrder++
+			link.Order = lastOrder
+			cast = append(cast, CastMember{PersonID: person.ID, Name: person.Name, Order: lastOrder})
+			i = len(cast) - 1
+		}
+		if link.Character, err = in.promptDefault("  as (or press Enter to skip)", cast[i].Character); err != nil {
+			return err
+		}
+		err = journaled(store, fmt.Sprintf("cast '%s' in '%s'", person.Name, movie.Title), func(tx MovieStore, c *journalChange) error {
+			if err := c.touchMovies(movieID); err != nil {
+				return err
+			}
+			return tx.LinkActor(link)
+		})
+		if err != nil {
+			return fmt.Errorf("linking actor: %w", err)
+		}
+		cast[i].Character = link.Character
+	}
+}
+
+// castIndex returns the position of the person in the cast, or -1.
+func castIndex(cast []CastMember, personID int) int {
+	for i, c := range cast {
+		if c.PersonID == personID {
+			return i
+		}
+	}
+	return -1
+}
+
+// editPerson implements `e -p`. It asks for the person, then for their name
+// and dates with the current values as defaults.
+func editPerson(store MovieStore, in *console) error {
+	name, err := in.prompt("Enter the name of the person to edit: ")
+	if err != nil {
+		return err
+	}
+	found, err := lookupPerson(store, name)
+	if err == ErrNotFound {
+		return fmt.Errorf("person '%s' %w", name, ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+	person := *found
+
+	if person.Name, err = in.promptDefault("Name", person.Name); err != nil {
+		return err
+	}
+
+	// Input year or date of birth
+	born := ""
+	if !person.BirthDate.IsZero() {
+		born = person.BirthDate.Format("2006-01-02")
+	} else if person.BirthYear != 0 {
+		born = fmt.Sprint(person.BirthYear)
+	}
+	for {
+		input, err := in.promptDefault("Year or date of birth (YYYY or YYYY-MM-DD, - to clear)", born)
+		if err != nil {
+			return err
+		}
+		if input == "" || input == clearAnswer {
+			person.BirthYear, person.BirthDate = 0, time.Time{}
+			break
+		}
+		if person.BirthYear, person.BirthDate, err = parseYearOrDate(input); err != nil {
+			if err := in.retry("Error: Invalid year of birth. Please enter a year or a YYYY-MM-DD date.", fmt.Errorf("invalid year of birth %q", input)); err != nil {
+				return err
+			}
+		} else {
+			break
+		}
+	}
+
+	// Input date of death
+	died := ""
+	if !person.DeathDate.IsZero() {
+		died = person.DeathDate.Format("2006-01-02")
+	}
+	for {
+		input, err := in.promptDefault("Date of death (YYYY-MM-DD, - to clear)", died)
+		if err != nil {
+			return err
+		}
+		if input == "" || input == clearAnswer {
+			person.DeathDate = time.Time{}
+			break
+		}
+		if person.DeathDate, err = parseDate(input); err != nil {
+			if err := in.retry("Error: Invalid date of death. Please enter a YYYY-MM-DD date.", err); err != nil {
+				return err
+			}
+		} else {
+			break
+		}
+	}
+
+	if err := validatePerson(person); err != nil {
+		return err
+	}
+	// Like adding, editing must not create a second person with the same
+	// name and birth year
+	namesakes, err := store.PeopleByName(person.Name)
+	if err != nil {
+		return fmt.Errorf("checking for person '%s': %w", person.Name, err)
+	}
+	for _, other := range namesakes {
+		if other.ID != person.ID && other.BirthYear == person.BirthYear {
+			return fmt.Errorf("person '%s' %w", person.Name, ErrAlreadyExists)
+		}
+	}
+
+	err = journaled(store, fmt.Sprintf("edit person '%s'", found.Name), func(tx MovieStore, c *journalChange) error {
+		if err := c.touchPeople(person.ID); err != nil {
+			return err
+		}
+		return tx.UpdatePerson(person)
+	})
+	if err != nil {
+		return fmt.Errorf("updating person: %w", err)
+	}
+	fmt.Printf("Successfully updated person: %s (Birth Year: %d)\n", person.Name, person.BirthYear)
+	return nil
+}
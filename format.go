@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listFormats are the accepted values of `l --format`. "text" is the
+// human-readable default.
+var listFormats = []string{"text", "json", "csv", "tsv", "yaml"}
+
+// collectListing loads the movies selected by opts in the same shape the REST
+// API returns. In verbose mode every movie carries its cast.
+func collectListing(store MovieStore, opts listOptions) ([]apiMovie, error) {
+	movies, err := store.ListMovies(opts.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("executing query: %w", err)
+	}
+
+	result := make([]apiMovie, 0, len(movies))
+	for _, m := range movies {
+		movie := toAPIMovie(m)
+		if opts.Verbose {
+			credits, err := store.MovieCredits(m.ID)
+			if err != nil {
+				return nil, fmt.Errorf("fetching crew for movie: %w", err)
+			}
+			movie.Crew = toAPICrew(credits)
+
+			cast, err := store.MovieCast(m.ID, opts.Filter.Actor)
+			if err != nil {
+				return nil, fmt.Errorf("fetching actors for movie: %w", err)
+			}
+			movie.Cast = toAPICast(cast)
+		}
+		result = append(result, movie)
+	}
+	return result, nil
+}
+
+// writeListing writes movies in one of the structured list formats.
+func writeListing(w io.Writer, format string, movies []apiMovie, verbose bool) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(movies)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(movies); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "csv":
+		return writeDelimited(w, ',', movies, verbose)
+	case "tsv":
+		return writeDelimited(w, '\t', movies, verbose)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// writeDelimited writes one row per movie. Verbose output has one row per cast
+// member instead, repeating the movie columns, since CSV cannot nest.
+func writeDelimited(w io.Writer, comma rune, movies []apiMovie, verbose bool) error {
+	out := csv.NewWriter(w)
+	out.Comma = comma
+
+	header := []string{"id", "title", "director", "release_year", "length_minutes", "genres", "rating", "rated_at", "review"}
+	if verbose {
+		header = append(header, "actor_id", "actor", "actor_age", "character", "billing_order")
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, m := range movies {
+		row := []string{
+			strconv.Itoa(m.ID),
+			m.Title,
+			m.Director,
+			strconv.Itoa(m.ReleaseYear),
+			strconv.Itoa(m.LengthMinutes),
+			strings.Join(m.Genres, ", "),
+			"", "", "",
+		}
+		if m.Rating != nil {
+			row[6], row[7], row[8] = strconv.Itoa(m.Rating.Score), m.Rating.RatedAt, m.Rating.Review
+		}
+		if !verbose {
+			if err := out.Write(row); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(m.Cast) == 0 {
+			// Keep movies without a (matching) cast in the output
+			if err := out.Write(append(row, "", "", "", "", "")); err != nil {
+				return err
+			}
+		}
+		for _, c := range m.Cast {
+			age, order := "", ""
+			if c.Age != nil {
+				age = strconv.Itoa(*c.Age)
+			}
+			if c.Order != nil {
+				order = strconv.Itoa(*c.Order)
+			}
+			if err := out.Write(append(row[:len(row):len(row)], strconv.Itoa(c.ID), c.Name, age, c.Character, order)); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -2,9 +2,15 @@ module nokia.dev/go/io
 
 go 1.23.3
 
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/levigross/grequests v0.0.0-20231203190023-9c307ef1f48d // indirect
-	github.com/lib/pq v1.10.9 // indirect
 	golang.org/x/net v0.19.0 // indirect
 )
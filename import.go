@@ -0,0 +1,467 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importFields lists the fields each kind of import file provides. The first
+// fields of every kind are required.
+var importFields = map[string][]string{
+	"people": {"name", "birth_year", "birth_date", "death_date"},
+	"movies": {"title", "director", "release_year", "length", "genres", "release_date"},
+	"cast":   {"title", "actor", "director", "character", "order"},
+}
+
+// requiredImportFields is how many of importFields are mandatory per kind.
+var requiredImportFields = map[string]int{
+	"people": 1,
+	"movies": 4,
+	"cast":   2,
+}
+
+type importOptions struct {
+	Kind   string // people, movies or cast
+	Path   string
+	Format string // csv, tsv or json; guessed from the extension if empty
+	// Mapping maps a field to the column (or JSON key) holding it. Unmapped
+	// fields are read from the column of the same name.
+	Mapping      map[string]string
+	AllOrNothing bool
+}
+
+// importRecord is one row of an import file, keyed by field name.
+type importRecord struct {
+	row    int // line in a CSV file, position in a JSON array
+	values map[string]string
+}
+
+// importReport collects the outcome of an import for the validation report.
+type importReport struct {
+	imported int
+	skipped  int
+	rejected []string
+}
+
+func runImportCommand(args []string) error {
+	fs := newCommandFlagSet("import")
+	format := fs.String("format", "", "csv, tsv or json (default: from the file extension)")
+	allOrNothing := fs.Bool("all-or-nothing", false, "import nothing unless every row is valid")
+	var mappings stringList
+	fs.Var(&mappings, "map", "field=column mapping (repeatable)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return usageError{"usage: import [-format csv|tsv|json] [-map field=column]... [-all-or-nothing] people|movies|cast FILE"}
+	}
+
+	opts := importOptions{Kind: rest[0], Path: rest[1], Format: *format, AllOrNothing: *allOrNothing, Mapping: map[string]string{}}
+	fields, ok := importFields[opts.Kind]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown import kind %q (use people, movies or cast)", opts.Kind)}
+	}
+	for _, m := range mappings {
+		field, column, ok := strings.Cut(m, "=")
+		if !ok || column == "" {
+			return usageError{fmt.Sprintf("bad mapping %q, expected field=column", m)}
+		}
+		if !containsString(fields, field) {
+			return usageError{fmt.Sprintf("unknown %s field %q (use %s)", opts.Kind, field, strings.Join(fields, ", "))}
+		}
+		opts.Mapping[field] = column
+	}
+	if opts.Format == "" {
+		opts.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.Path)), ".")
+	}
+	if opts.Format != "csv" && opts.Format != "tsv" && opts.Format != "json" {
+		return usageError{fmt.Sprintf("unknown import format %q (use -format csv, tsv or json)", opts.Format)}
+	}
+
+	records, err := readImportFile(opts)
+	if err != nil {
+		return err
+	}
+	return withCatalog(func(store MovieStore) error {
+		return importRecords(store, opts, records)
+	})
+}
+
+// readImportFile reads every row of the file and renames its columns to
+// field names.
+func readImportFile(opts importOptions) ([]importRecord, error) {
+	file, err := os.Open(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	column := func(field string) string {
+		if c, ok := opts.Mapping[field]; ok {
+			return c
+		}
+		return field
+	}
+	fields := importFields[opts.Kind]
+
+	if opts.Format == "json" {
+		var rows []map[string]interface{}
+		decoder := json.NewDecoder(file)
+		decoder.UseNumber()
+		if err := decoder.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("parsing %s: expected an array of objects: %w", opts.Path, err)
+		}
+
+		records := make([]importRecord, 0, len(rows))
+		for i, row := range rows {
+			rec := importRecord{row: i + 1, values: map[string]string{}}
+			for _, field := range fields {
+				switch v := row[column(field)].(type) {
+				case nil:
+				case string:
+					rec.values[field] = strings.TrimSpace(v)
+				case json.Number:
+					rec.values[field] = v.String()
+				default:
+					// Reported by validation as a bad value
+					rec.values[field] = fmt.Sprint(v)
+				}
+			}
+			records = append(records, rec)
+		}
+		return records, nil
+	}
+
+	reader := csv.NewReader(file)
+	if opts.Format == "tsv" {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", opts.Path, err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	for _, field := range fields[:requiredImportFields[opts.Kind]] {
+		if _, ok := index[column(field)]; !ok {
+			return nil, fmt.Errorf("%s has no column %q (map the %s field with -map %s=COLUMN)", opts.Path, column(field), field, field)
+		}
+	}
+
+	var records []importRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", opts.Path, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		rec := importRecord{row: line, values: map[string]string{}}
+		for _, field := range fields {
+			if i, ok := index[column(field)]; ok && i < len(row) {
+				rec.values[field] = strings.TrimSpace(row[i])
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// importRecords validates and stores every record and prints a report.
+// Without AllOrNothing valid rows are kept even if others are rejected.
+func importRecords(store MovieStore, opts importOptions, records []importRecord) error {
+	var report importReport
+	apply := func(store MovieStore) error {
+		for _, rec := range records {
+			created, err := importRecordInto(store, opts.Kind, rec)
+			switch {
+			case err != nil:
+				report.rejected = append(report.rejected, fmt.Sprintf("%s:%d: %v", opts.Path, rec.row, err))
+			case created:
+				report.imported++
+			default:
+				report.skipped++
+			}
+		}
+		if opts.AllOrNothing && len(report.rejected) > 0 {
+			return errImportRejected
+		}
+		return nil
+	}
+
+	var err error
+	if opts.AllOrNothing {
+		err = store.Atomically(apply)
+	} else {
+		err = apply(store)
+	}
+	if err != nil && !errors.Is(err, errImportRejected) {
+		return err
+	}
+
+	if opts.AllOrNothing && len(report.rejected) > 0 {
+		fmt.Printf("Imported nothing from %s: %d of %d rows rejected.\n", opts.Path, len(report.rejected), len(records))
+	} else {
+		fmt.Printf("Imported %d of %d %s rows from %s", report.imported, len(records), opts.Kind, opts.Path)
+		if report.skipped > 0 {
+			fmt.Printf(" (%d already in the catalog)", report.skipped)
+		}
+		fmt.Println(".")
+	}
+	if len(report.rejected) == 0 {
+		return nil
+	}
+
+	fmt.Println("Rejected rows:")
+	for _, r := range report.rejected {
+		fmt.Println("  " + r)
+	}
+	return fmt.Errorf("%d row(s) rejected", len(report.rejected))
+}
+
+var errImportRejected = errors.New("rows rejected")
+
+// importRecordInto stores one record. It reports created=false for rows that
+// are already in the catalog.
+func importRecordInto(store MovieStore, kind string, rec importRecord) (created bool, err error) {
+	v := rec.values
+	for _, field := range importFields[kind][:requiredImportFields[kind]] {
+		if v[field] == "" {
+			return false, fmt.Errorf("missing %s", field)
+		}
+	}
+
+	switch kind {
+	case "people":
+		person := Person{Name: v["name"]}
+		if v["birth_year"] != "" {
+			if person.BirthYear, err = parseImportYear(v["birth_year"]); err != nil {
+				return false, fmt.Errorf("bad birth year: %w", err)
+			}
+		}
+		if v["birth_date"] != "" {
+			if person.BirthDate, err = parseImportDate(v["birth_date"], person.BirthYear); err != nil {
+				return false, fmt.Errorf("bad birth date: %w", err)
+			}
+			person.BirthYear = person.BirthDate.Year()
+		}
+		if v["death_date"] != "" {
+			if person.DeathDate, err = parseDate(v["death_date"]); err != nil {
+				return false, fmt.Errorf("bad death date: %w", err)
+			}
+			if person.DeathDate.Year() < person.BirthYear || person.DeathDate.Before(person.BirthDate) {
+				return false, fmt.Errorf("death date %s is before the birth", v["death_date"])
+			}
+		}
+		err = journaled(store, fmt.Sprintf("import person '%s'", person.Name), func(tx MovieStore, c *journalChange) error {
+			id, added, err := tx.AddPerson(person)
+			if added {
+				c.addedPerson(id)
+			}
+			created = added
+			return err
+		})
+		return created, err
+
+	case "movies":
+		director, err := lookupPerson(store, v["director"])
+		if errors.Is(err, ErrNotFound) {
+			return false, fmt.Errorf("unknown director '%s'", v["director"])
+		} else if err != nil {
+			return false, err
+		}
+		year, err := parseImportYear(v["release_year"])
+		if err != nil {
+			return false, fmt.Errorf("bad release year: %w", err)
+		}
+		var released time.Time
+		if v["release_date"] != "" {
+			if released, err = parseImportDate(v["release_date"], year); err != nil {
+				return false, fmt.Errorf("bad release date: %w", err)
+			}
+		}
+		length, err := parseImportLength(v["length"])
+		if err != nil {
+			return false, err
+		}
+
+		// Look for the movie first: a failed insert would abort a Postgres
+		// transaction, and with it an all-or-nothing import.
+		if _, err := findMovie(store, v["title"], director.Name); err == nil {
+			return false, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			return false, err
+		}
+		movie := Movie{Title: v["title"], DirectorID: director.ID, ReleaseYear: year, ReleaseDate: released, LengthMinutes: length}
+		err = journaled(store, fmt.Sprintf("import movie '%s'", movie.Title), func(tx MovieStore, c *journalChange) error {
+			movieID, err := tx.AddMovie(movie)
+			if err != nil {
+				return err
+			}
+			c.addedMovie(movieID)
+			// Genres are a comma separated list, as written by `l --format csv`
+			return linkGenres(tx, movieID, strings.Split(v["genres"], ","))
+		})
+		if errors.Is(err, ErrAlreadyExists) {
+			return false, nil
+		}
+		return err == nil, err
+
+	case "cast":
+		movie, err := findMovie(store, v["title"], v["director"])
+		if err != nil {
+			return false, err
+		}
+		actor, err := lookupPerson(store, v["actor"])
+		if errors.Is(err, ErrNotFound) {
+			return false, fmt.Errorf("unknown actor '%s'", v["actor"])
+		} else if err != nil {
+			return false, err
+		}
+		order := 0
+		if v["order"] != "" {
+			if order, err = strconv.Atoi(v["order"]); err != nil || order <= 0 {
+				return false, fmt.Errorf("bad billing order %q", v["order"])
+			}
+		}
+		err = journaled(store, fmt.Sprintf("cast '%s' in '%s'", actor.Name, movie.Title), func(tx MovieStore, c *journalChange) error {
+			if err := c.touchMovies(movie.ID); err != nil {
+				return err
+			}
+			return tx.LinkActor(CastLink{MovieID: movie.ID, ActorID: actor.ID, Character: v["character"], Order: order})
+		})
+		return err == nil, err
+	}
+	return false, fmt.Errorf("unknown import kind %q", kind)
+}
+
+// ErrAmbiguousTitle is returned by findMovie when several movies have the
+// title.
+var ErrAmbiguousTitle = errors.New("is ambiguous")
+
+// findMovie looks a movie up by its exact title and, if given, director. It
+// fails if the title alone is ambiguous.
+func findMovie(store MovieStore, title, director string) (*MovieListing, error) {
+	filter := MovieFilter{Title: regexp.MustCompile("^" + regexp.QuoteMeta(title) + "$")}
+	if director != "" {
+		filter.Director = regexp.MustCompile("^" + regexp.QuoteMeta(director) + "$")
+	}
+	movies, err := store.ListMovies(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(movies) {
+	case 0:
+		if director != "" {
+			return nil, fmt.Errorf("movie '%s' by %s %w", title, director, ErrNotFound)
+		}
+		return nil, fmt.Errorf("movie '%s' %w", title, ErrNotFound)
+	case 1:
+		return &movies[0], nil
+	default:
+		var directors []string
+		for _, m := range movies {
+			directors = append(directors, m.Director)
+		}
+		sort.Strings(directors)
+		return nil, fmt.Errorf("movie title '%s' %w (directed by %s); add a director", title, ErrAmbiguousTitle, strings.Join(directors, ", "))
+	}
+}
+
+// findMovieReleased is findMovie with a release year instead of a director;
+// year 0 matches every year.
+func findMovieReleased(store MovieStore, title string, year int) (*MovieListing, error) {
+	movies, err := store.ListMovies(MovieFilter{Title: regexp.MustCompile("^" + regexp.QuoteMeta(title) + "$")})
+	if err != nil {
+		return nil, err
+	}
+	matches := movies[:0]
+	for _, m := range movies {
+		if year == 0 || m.ReleaseYear == year {
+			matches = append(matches, m)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		if year != 0 {
+			return nil, fmt.Errorf("movie '%s' from %d %w", title, year, ErrNotFound)
+		}
+		return nil, fmt.Errorf("movie '%s' %w", title, ErrNotFound)
+	case 1:
+		return &matches[0], nil
+	default:
+		var releases []string
+		for _, m := range matches {
+			releases = append(releases, fmt.Sprintf("%d %s", m.ReleaseYear, byDirector(m.Director)))
+		}
+		sort.Strings(releases)
+		if year != 0 {
+			return nil, fmt.Errorf("movie '%s' from %d %w (%s)", title, year, ErrAmbiguousTitle, strings.Join(releases, ", "))
+		}
+		return nil, fmt.Errorf("movie title '%s' %w (%s); add the year", title, ErrAmbiguousTitle, strings.Join(releases, ", "))
+	}
+}
+
+func parseImportYear(s string) (int, error) {
+	year, err := strconv.Atoi(s)
+	if err != nil || year <= 0 {
+		return 0, fmt.Errorf("%q is not a valid year", s)
+	}
+	return year, nil
+}
+
+// parseImportDate parses a YYYY-MM-DD date, which must fall in year unless
+// that is 0.
+func parseImportDate(s string, year int) (time.Time, error) {
+	date, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if year != 0 && date.Year() != year {
+		return time.Time{}, fmt.Errorf("%s is not in %d", s, year)
+	}
+	return date, nil
+}
+
+// parseImportLength accepts the hh:mm format of the prompts as well as a
+// plain number of minutes, as found in most exports.
+func parseImportLength(s string) (int, error) {
+	if strings.Contains(s, ":") {
+		return parseLength(s)
+	}
+	minutes, err := strconv.Atoi(s)
+	if err != nil || minutes <= 0 {
+		return 0, fmt.Errorf("bad length %q, expected hh:mm or minutes", s)
+	}
+	return minutes, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
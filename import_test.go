@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// importFile writes content to a file named name and imports it into store.
+func importFile(t *testing.T, store MovieStore, opts importOptions, name, content string) error {
+	t.Helper()
+	opts.Path = filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(opts.Path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Format == "" {
+		opts.Format = filepath.Ext(name)[1:]
+	}
+	records, err := readImportFile(opts)
+	if err != nil {
+		t.Fatalf("readImportFile(%s): %v", name, err)
+	}
+	return importRecords(store, opts, records)
+}
+
+func TestImportFormats(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		people := "name,birth_year\nRidley Scott,1937\nSigourney Weaver,\n"
+		if err := importFile(t, store, importOptions{Kind: "people"}, "people.csv", people); err != nil {
+			t.Fatal(err)
+		}
+		movies := "title\tdirector\trelease_year\tlength\tgenres\nAlien\tRidley Scott\t1979\t1:57\tHorror, Sci-Fi\nBlade Runner\tRidley Scott\t1982\t117\t\n"
+		if err := importFile(t, store, importOptions{Kind: "movies"}, "movies.tsv", movies); err != nil {
+			t.Fatal(err)
+		}
+		cast := `[{"title": "Alien", "actor": "Sigourney Weaver", "director": "Ridley Scott"}]`
+		if err := importFile(t, store, importOptions{Kind: "cast"}, "cast.json", cast); err != nil {
+			t.Fatal(err)
+		}
+
+		if person, err := personByName(store, "Ridley Scott"); err != nil || person.BirthYear != 1937 {
+			t.Errorf("imported director = %+v, %v", person, err)
+		}
+		movie, err := findMovie(store, "Alien", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.ReleaseYear != 1979 || movie.LengthMinutes != 117 || strings.Join(movie.Genres, ",") != "Horror,Sci-Fi" {
+			t.Errorf("imported movie = %+v", movie)
+		}
+		if cast, err := store.MovieCast(movie.ID, nil); err != nil || len(cast) != 1 || cast[0].Name != "Sigourney Weaver" {
+			t.Errorf("imported cast = %+v, %v", cast, err)
+		}
+
+		// Importing the same rows again skips them
+		if err := importFile(t, store, importOptions{Kind: "movies"}, "movies.tsv", movies); err != nil {
+			t.Errorf("importing the movies again: %v", err)
+		}
+		if n, err := store.CountMovies(); err != nil || n != 2 {
+			t.Errorf("CountMovies after importing twice = %d, %v; want 2", n, err)
+		}
+	})
+}
+
+func TestImportMapping(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		opts := importOptions{Kind: "people", Mapping: map[string]string{"name": "Full Name", "birth_year": "Born"}}
+		if err := importFile(t, store, opts, "people.csv", "Full Name,Born\nHarrison Ford,1942\n"); err != nil {
+			t.Fatal(err)
+		}
+		if person, err := personByName(store, "Harrison Ford"); err != nil || person.BirthYear != 1942 {
+			t.Errorf("person imported through a mapping = %+v, %v", person, err)
+		}
+
+		opts = importOptions{Kind: "people", Mapping: map[string]string{"name": "full_name"}}
+		if err := importFile(t, store, opts, "people.json", `[{"full_name": "Carrie Fisher"}]`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := personByName(store, "Carrie Fisher"); err != nil {
+			t.Errorf("person imported through a JSON mapping: %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "people.csv")
+		if err := os.WriteFile(path, []byte("Full Name\nMark Hamill\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readImportFile(importOptions{Kind: "people", Path: path, Format: "csv"}); err == nil {
+			t.Error("readImportFile of a file without a name column succeeded")
+		}
+	})
+}
+
+func TestImportAllOrNothing(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		movies := "title,director,release_year,length\nAlien,Ridley Scott,1979,117\nGladiator,Nobody,2000,155\n"
+
+		err := importFile(t, store, importOptions{Kind: "movies", AllOrNothing: true}, "movies.csv", movies)
+		if err == nil {
+			t.Fatal("import with a rejected row succeeded")
+		}
+		if n, err := store.CountMovies(); err != nil || n != 0 {
+			t.Errorf("CountMovies after a rejected all-or-nothing import = %d, %v; want 0", n, err)
+		}
+
+		// A row already in the catalog is skipped rather than rejected
+		if _, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117}); err != nil {
+			t.Fatal(err)
+		}
+		movies = "title,director,release_year,length\nAlien,Ridley Scott,1979,117\nBlade Runner,Ridley Scott,1982,117\n"
+		if err := importFile(t, store, importOptions{Kind: "movies", AllOrNothing: true}, "movies.csv", movies); err != nil {
+			t.Fatalf("all-or-nothing import of a movie already in the catalog: %v", err)
+		}
+		if _, err := findMovie(store, "Blade Runner", ""); err != nil {
+			t.Errorf("the valid row was not imported: %v", err)
+		}
+
+		err = importFile(t, store, importOptions{Kind: "movies"}, "movies.csv", "title,director,release_year,length\nGladiator,Nobody,2000,155\nLegend,Ridley Scott,1985,94\n")
+		if err == nil {
+			t.Error("import with a rejected row succeeded")
+		}
+		if _, err := findMovie(store, "Legend", ""); err != nil {
+			t.Errorf("without -all-or-nothing the valid row was not imported: %v", err)
+		}
+		if _, err := findMovie(store, "Gladiator", ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("findMovie of the rejected row: err = %v; want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// journalChange tracks the people and movies a journaled change touches and
+// how they were before it.
+type journalChange struct {
+	tx     MovieStore
+	before journalState
+	people map[int]bool
+	movies map[int]bool
+}
+
+// journalState is how the records a change touches looked on one side of
+// it. Touched records missing from People or Movies did not exist.
+type journalState struct {
+	PeopleIDs []int        `json:"people_ids"`
+	MovieIDs  []int        `json:"movie_ids"`
+	People    []Person     `json:"people"`
+	Movies    []movieState `json:"movies"`
+}
+
+// movieState is a movie with everything linked to it that the journal
+// restores. Ratings and watch history are per user and not journaled, so
+// undoing a movie's deletion does not bring them back.
+type movieState struct {
+	Movie   Movie      `json:"movie"`
+	Cast    []CastLink `json:"cast"`
+	Credits []Credit   `json:"credits"`
+	Genres  []string   `json:"genres"`
+}
+
+// journaled runs change in a transaction, records it in the journal as
+// summary, so `undo` can revert it, and in the audit log. change reports the
+// records it touches through c: existing ones before it modifies or deletes
+// them, new ones once it has added them.
+func journaled(store MovieStore, summary string, change func(tx MovieStore, c *journalChange) error) error {
+	return store.Atomically(func(tx MovieStore) error {
+		c := &journalChange{tx: tx, people: map[int]bool{}, movies: map[int]bool{}}
+		if err := change(tx, c); err != nil {
+			return err
+		}
+		before := c.before
+		if len(before.PeopleIDs) == 0 && len(before.MovieIDs) == 0 {
+			return nil // nothing to undo
+		}
+		after, err := snapshotState(tx, before.PeopleIDs, before.MovieIDs)
+		if err != nil {
+			return fmt.Errorf("journaling %s: %w", summary, err)
+		}
+
+		entry := JournalEntry{Summary: summary, RecordedAt: time.Now().UTC()}
+		if entry.Before, err = encodeState(before); err != nil {
+			return err
+		}
+		if entry.After, err = encodeState(after); err != nil {
+			return err
+		}
+		if err := tx.RecordChange(entry); err != nil {
+			return fmt.Errorf("journaling %s: %w", summary, err)
+		}
+		return auditChange(tx, summary, before, after)
+	})
+}
+
+// touchPeople notes people the change is about to modify or delete.
+// Touching someone twice keeps the first snapshot.
+func (c *journalChange) touchPeople(ids ...int) error {
+	for _, id := range ids {
+		if c.people[id] {
+			continue
+		}
+		c.people[id] = true
+		c.before.PeopleIDs = append(c.before.PeopleIDs, id)
+		person, err := c.tx.PersonByID(id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		c.before.People = append(c.before.People, *person)
+	}
+	return nil
+}
+
+// touchMovies is touchPeople for movies and everything linked to them.
+func (c *journalChange) touchMovies(ids ...int) error {
+	for _, id := range ids {
+		if c.movies[id] {
+			continue
+		}
+		c.movies[id] = true
+		c.before.MovieIDs = append(c.before.MovieIDs, id)
+		m, err := readMovieState(c.tx, id)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			c.before.Movies = append(c.before.Movies, *m)
+		}
+	}
+	return nil
+}
+
+// addedPerson notes a person the change created.
+func (c *journalChange) addedPerson(id int) {
+	if !c.people[id] {
+		c.people[id] = true
+		c.before.PeopleIDs = append(c.before.PeopleIDs, id)
+	}
+}
+
+// addedMovie notes a movie the change created.
+func (c *journalChange) addedMovie(id int) {
+	if !c.movies[id] {
+		c.movies[id] = true
+		c.before.MovieIDs = append(c.before.MovieIDs, id)
+	}
+}
+
+// upsertPerson is UpsertPerson within the change. Everyone it might update,
+// those with the name or TMDb ID, is touched first.
+func (c *journalChange) upsertPerson(person Person) (int, bool, error) {
+	candidates, err := c.tx.PeopleByName(person.Name)
+	if err != nil {
+		return 0, false, err
+	}
+	if person.TMDbID != 0 {
+		match, err := c.tx.PersonByTMDbID(person.TMDbID)
+		if err == nil {
+			candidates = append(candidates, *match)
+		} else if !errors.Is(err, ErrNotFound) {
+			return 0, false, err
+		}
+	}
+	for _, p := range candidates {
+		if err := c.touchPeople(p.ID); err != nil {
+			return 0, false, err
+		}
+	}
+
+	id, created, err := c.tx.UpsertPerson(person)
+	if err != nil {
+		return 0, false, err
+	}
+	if created {
+		c.addedPerson(id)
+	}
+	return id, created, nil
+}
+
+// snapshotState reads the people and movies as they are now.
+func snapshotState(store MovieStore, peopleIDs, movieIDs []int) (journalState, error) {
+	state := journalState{PeopleIDs: peopleIDs, MovieIDs: movieIDs}
+	for _, id := range peopleIDs {
+		person, err := store.PersonByID(id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return state, err
+		}
+		state.People = append(state.People, *person)
+	}
+	for _, id := range movieIDs {
+		m, err := readMovieState(store, id)
+		if err != nil {
+			return state, err
+		}
+		if m != nil {
+			state.Movies = append(state.Movies, *m)
+		}
+	}
+	return state, nil
+}
+
+// readMovieState reads a movie with its links, or returns nil if it does not
+// exist.
+func readMovieState(store MovieStore, id int) (*movieState, error) {
+	listing, err := store.MovieByID(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &movieState{
+		Movie: Movie{
+			ID:            listing.ID,
+			Title:         listing.Title,
+			DirectorID:    listing.DirectorID,
+			ReleaseYear:   listing.ReleaseYear,
+			ReleaseDate:   listing.ReleaseDate,
+			LengthMinutes: listing.LengthMinutes,
+			TMDbID:        listing.TMDbID,
+			TrashedAt:     listing.TrashedAt,
+		},
+		Genres: listing.Genres,
+	}
+
+	cast, err := store.MovieCast(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cast {
+		m.Cast = append(m.Cast, CastLink{MovieID: id, ActorID: c.PersonID, Character: c.Character, Order: c.Order})
+	}
+	if m.Credits, err = store.MovieCredits(id); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func encodeState(state journalState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("encoding journal state: %w", err)
+	}
+	return string(data), nil
+}
+
+// restoreState makes the records the state covers look as recorded:
+// people and movies are written back with their IDs and links, and those that
+// did not exist are deleted.
+func restoreState(store MovieStore, state journalState) error {
+	// People first, so the movies can refer to them
+	present := map[int]bool{}
+	for _, p := range state.People {
+		if err := store.PutPerson(p); err != nil {
+			return fmt.Errorf("restoring person '%s': %w", p.Name, err)
+		}
+		present[p.ID] = true
+	}
+
+	movies := map[int]bool{}
+	for _, m := range state.Movies {
+		if err := store.PutMovie(m.Movie); err != nil {
+			return fmt.Errorf("restoring movie '%s': %w", m.Movie.Title, err)
+		}
+		if err := restoreLinks(store, m); err != nil {
+			return fmt.Errorf("restoring movie '%s': %w", m.Movie.Title, err)
+		}
+		movies[m.Movie.ID] = true
+	}
+	for _, id := range state.MovieIDs {
+		if movies[id] {
+			continue
+		}
+		if err := store.DeleteMovie(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("deleting movie %d: %w", id, err)
+		}
+	}
+
+	for _, id := range state.PeopleIDs {
+		if present[id] {
+			continue
+		}
+		if _, err := store.PersonByID(id); errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := store.DeletePerson(id); err != nil {
+			return fmt.Errorf("deleting person %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// restoreLinks makes a movie's cast, crew and genres those recorded.
+func restoreLinks(store MovieStore, m movieState) error {
+	id := m.Movie.ID
+
+	cast, err := store.MovieCast(id, nil)
+	if err != nil {
+		return err
+	}
+	missing := map[int]CastLink{}
+	for _, link := range m.Cast {
+		missing[link.ActorID] = link
+	}
+	for _, c := range cast {
+		if link, ok := missing[c.PersonID]; ok && link.Character == c.Character && link.Order == c.Order {
+			delete(missing, c.PersonID)
+			continue
+		}
+		// Relinked below if only the role changed, since LinkActor keeps
+		// the character of an existing link
+		if err := store.UnlinkActor(id, c.PersonID); err != nil {
+			return err
+		}
+	}
+	for _, link := range m.Cast {
+		if _, ok := missing[link.ActorID]; ok {
+			if err := store.LinkActor(link); err != nil {
+				return err
+			}
+		}
+	}
+
+	credits, err := store.MovieCredits(id)
+	if err != nil {
+		return err
+	}
+	type job struct {
+		personID int
+		job      string
+	}
+	wanted := map[job]bool{}
+	for _, c := range m.Credits {
+		wanted[job{c.PersonID, c.Job}] = true
+	}
+	for _, c := range credits {
+		if wanted[job{c.PersonID, c.Job}] {
+			delete(wanted, job{c.PersonID, c.Job})
+		} else if err := store.RemoveCredit(id, c.PersonID, c.Job); err != nil {
+			return err
+		}
+	}
+	for j := range wanted {
+		if err := store.AddCredit(id, j.personID, j.job); err != nil {
+			return err
+		}
+	}
+
+	genres, err := store.MovieGenres(id)
+	if err != nil {
+		return err
+	}
+	tagged := map[string]bool{}
+	for _, g := range m.Genres {
+		tagged[g] = true
+	}
+	for _, g := range genres {
+		if tagged[g] {
+			delete(tagged, g)
+		} else if err := store.UnlinkGenre(id, g); err != nil {
+			return err
+		}
+	}
+	for g := range tagged {
+		if err := store.LinkGenre(id, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoChange implements `undo` and, with redo set, `redo`: it reverts the
+// latest change that is not undone, or reapplies the earliest undone one.
+func undoChange(store MovieStore, redo bool) error {
+	verb := "undo"
+	if redo {
+		verb = "redo"
+	}
+
+	var summary string
+	err := store.Atomically(func(tx MovieStore) error {
+		entry, err := tx.NextChange(redo)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		summary = entry.Summary
+
+		state := entry.Before
+		if redo {
+			state = entry.After
+		}
+		var target journalState
+		if err := json.Unmarshal([]byte(state), &target); err != nil {
+			return fmt.Errorf("reading journal entry %d: %w", entry.ID, err)
+		}
+		before, err := snapshotState(tx, target.PeopleIDs, target.MovieIDs)
+		if err != nil {
+			return err
+		}
+		if err := restoreState(tx, target); err != nil {
+			return fmt.Errorf("cannot %s %s: %w", verb, summary, err)
+		}
+		after, err := snapshotState(tx, target.PeopleIDs, target.MovieIDs)
+		if err != nil {
+			return err
+		}
+		if err := tx.MarkChange(entry.ID, !redo); err != nil {
+			return err
+		}
+		return auditChange(tx, verb+" "+summary, before, after)
+	})
+
+	switch {
+	case err != nil:
+		return err
+	case summary == "":
+		fmt.Printf("Nothing to %s.\n", verb)
+	case redo:
+		fmt.Printf("Redid: %s\n", summary)
+	default:
+		fmt.Printf("Undid: %s\n", summary)
+	}
+	return nil
+}
+
+// forgetRecords drops every journal entry that touches or links to one of
+// the people or movies, before they are deleted for good: undoing or redoing
+// such an entry would bring them back. It returns how many it dropped.
+func forgetRecords(tx MovieStore, peopleIDs, movieIDs []int) (int, error) {
+	people, movies := map[int]bool{}, map[int]bool{}
+	for _, id := range peopleIDs {
+		people[id] = true
+	}
+	for _, id := range movieIDs {
+		movies[id] = true
+	}
+
+	entries, err := tx.Changes()
+	if err != nil {
+		return 0, err
+	}
+	forgotten := 0
+	for _, e := range entries {
+		mentioned := false
+		for _, state := range []string{e.Before, e.After} {
+			var s journalState
+			if err := json.Unmarshal([]byte(state), &s); err != nil {
+				return 0, fmt.Errorf("reading journal entry %d: %w", e.ID, err)
+			}
+			mentioned = mentioned || s.mentions(people, movies)
+		}
+		if !mentioned {
+			continue
+		}
+		if err := tx.ForgetChange(e.ID); err != nil {
+			return 0, err
+		}
+		forgotten++
+	}
+	return forgotten, nil
+}
+
+// mentions reports whether the state touches one of the people or movies, or
+// links one of the people to a movie.
+func (s journalState) mentions(people, movies map[int]bool) bool {
+	for _, id := range s.PeopleIDs {
+		if people[id] {
+			return true
+		}
+	}
+	for _, id := range s.MovieIDs {
+		if movies[id] {
+			return true
+		}
+	}
+	for _, m := range s.Movies {
+		if people[m.Movie.DirectorID] {
+			return true
+		}
+		for _, link := range m.Cast {
+			if people[link.ActorID] {
+				return true
+			}
+		}
+		for _, c := range m.Credits {
+			if people[c.PersonID] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestJournalUndoRedo(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+
+		// states[i] is the catalog after i changes
+		states := [][]string{catalogContents(t, store)}
+		record := func(summary string, change func(tx MovieStore, c *journalChange) error) {
+			t.Helper()
+			if err := journaled(store, summary, change); err != nil {
+				t.Fatalf("%s: %v", summary, err)
+			}
+			states = append(states, catalogContents(t, store))
+		}
+		check := func(what string, want []string) {
+			t.Helper()
+			if got := catalogContents(t, store); !reflect.DeepEqual(got, want) {
+				t.Errorf("catalog after %s:\n%q\nwant:\n%q", what, got, want)
+			}
+		}
+
+		var director, actor, movieID int
+		record("add people", func(tx MovieStore, c *journalChange) error {
+			var err error
+			if director, _, err = tx.AddPerson(Person{Name: "Ridley Scott", BirthYear: 1937}); err != nil {
+				return err
+			}
+			if actor, _, err = tx.AddPerson(Person{Name: "Sigourney Weaver", BirthYear: 1949}); err != nil {
+				return err
+			}
+			c.addedPerson(director)
+			c.addedPerson(actor)
+			return nil
+		})
+		record("add movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+			var err error
+			if movieID, err = tx.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117}); err != nil {
+				return err
+			}
+			c.addedMovie(movieID)
+			if err := tx.LinkActor(CastLink{MovieID: movieID, ActorID: actor, Character: "Ripley", Order: 1}); err != nil {
+				return err
+			}
+			return tx.LinkGenre(movieID, "Horror")
+		})
+		record("edit movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+			if err := c.touchMovies(movieID); err != nil {
+				return err
+			}
+			return tx.UpdateMovie(Movie{ID: movieID, Title: "Alien: Director's Cut", DirectorID: director, ReleaseYear: 2003, LengthMinutes: 116})
+		})
+		record("delete person 'Sigourney Weaver'", func(tx MovieStore, c *journalChange) error {
+			if err := c.touchPeople(actor); err != nil {
+				return err
+			}
+			if err := c.touchMovies(movieID); err != nil {
+				return err
+			}
+			return tx.DeletePerson(actor)
+		})
+		record("delete movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+			if err := c.touchMovies(movieID); err != nil {
+				return err
+			}
+			return tx.DeleteMovie(movieID)
+		})
+
+		// Undo walks back through every change, cast and genres included
+		for i := len(states) - 2; i >= 0; i-- {
+			if err := undoChange(store, false); err != nil {
+				t.Fatalf("undo to state %d: %v", i, err)
+			}
+			check(fmt.Sprintf("undoing to state %d", i), states[i])
+		}
+		if err := undoChange(store, false); err != nil {
+			t.Errorf("undo with nothing left to undo: %v", err)
+		}
+		check("undoing with nothing left", states[0])
+
+		for i := 1; i < len(states); i++ {
+			if err := undoChange(store, true); err != nil {
+				t.Fatalf("redo to state %d: %v", i, err)
+			}
+			check(fmt.Sprintf("redoing to state %d", i), states[i])
+		}
+
+		// A new change forgets what was undone
+		if err := undoChange(store, false); err != nil {
+			t.Fatal(err)
+		}
+		record("delete person 'Ridley Scott'", func(tx MovieStore, c *journalChange) error {
+			if err := c.touchPeople(director); err != nil {
+				return err
+			}
+			if err := c.touchMovies(movieID); err != nil {
+				return err
+			}
+			if err := tx.DeleteMovie(movieID); err != nil {
+				return err
+			}
+			return tx.DeletePerson(director)
+		})
+		if err := undoChange(store, true); err != nil {
+			t.Fatal(err)
+		}
+		check("redoing after a new change", states[len(states)-1])
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		var director, movieID int
+		changes := []struct {
+			summary string
+			change  func(tx MovieStore, c *journalChange) error
+		}{
+			{"add movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+				var err error
+				if director, _, err = c.upsertPerson(Person{Name: "Ridley Scott", BirthYear: 1937}); err != nil {
+					return err
+				}
+				movieID, err = tx.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+				c.addedMovie(movieID)
+				return err
+			}},
+			{"edit movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+				// Touching a record without changing it logs nothing
+				if err := c.touchPeople(director); err != nil {
+					return err
+				}
+				if err := c.touchMovies(movieID); err != nil {
+					return err
+				}
+				return tx.UpdateMovie(Movie{ID: movieID, Title: "Alien: Director's Cut", DirectorID: director, ReleaseYear: 2003, LengthMinutes: 116})
+			}},
+			{"delete movie 'Alien'", func(tx MovieStore, c *journalChange) error {
+				if err := c.touchMovies(movieID); err != nil {
+					return err
+				}
+				return tx.DeleteMovie(movieID)
+			}},
+		}
+		for _, c := range changes {
+			if err := journaled(store, c.summary, c.change); err != nil {
+				t.Fatalf("%s: %v", c.summary, err)
+			}
+		}
+		if err := undoChange(store, false); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := store.AuditLog(AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, fmt.Sprintf("%s: %s %s %s '%s'", e.Summary, e.User, e.Operation, e.Entity, e.EntityName))
+		}
+		want := []string{
+			"add movie 'Alien': alice insert person 'Ridley Scott'",
+			"add movie 'Alien': alice insert movie 'Alien'",
+			"edit movie 'Alien': alice update movie 'Alien: Director's Cut'",
+			"delete movie 'Alien': alice delete movie 'Alien: Director's Cut'",
+			"undo delete movie 'Alien': alice insert movie 'Alien: Director's Cut'",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("audit log:\n%q\nwant:\n%q", got, want)
+		}
+
+		filters := []struct {
+			filter AuditFilter
+			want   int
+		}{
+			{AuditFilter{Entity: "person"}, 1},
+			{AuditFilter{Entity: "movie", Name: regexp.MustCompile("Cut")}, 3},
+			{AuditFilter{Since: time.Now().Add(time.Hour)}, 0},
+			{AuditFilter{Until: time.Now().Add(time.Hour)}, 5},
+		}
+		for _, f := range filters {
+			if entries, err := store.AuditLog(f.filter); err != nil || len(entries) != f.want {
+				t.Errorf("AuditLog(%+v) = %d entries, %v; want %d", f.filter, len(entries), err, f.want)
+			}
+		}
+	})
+}
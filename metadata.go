@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type TMDbMovieResult struct {
+	Page    int `json:"page"`
+	Results []struct {
+		ID          int    `json:"id"`
+		Title       string `json:"title"`
+		ReleaseDate string `json:"release_date"`
+	} `json:"results"`
+	TotalPages   int `json:"total_pages"`
+	TotalResults int `json:"total_results"`
+}
+
+type TMDbMovieDetails struct {
+	ID          int            `json:"id"`
+	Title       string         `json:"title"`
+	ReleaseDate string         `json:"release_date"`
+	Runtime     int            `json:"runtime"`
+	Director    TMDbCrewMember // the first of the directors in Crew
+	Crew        []TMDbCrewMember
+	Cast        []TMDbCastMember
+	Genres      []string
+}
+
+// TMDbCastMember is an actor and the character they played. Order is the
+// 0-based billing position.
+type TMDbCastMember struct {
+	ID        int    `json:"id"` // of the person
+	Name      string `json:"name"`
+	Character string `json:"character"`
+	Order     int    `json:"order"`
+}
+
+// TMDbCrewMember is a crew credit, such as a director or composer.
+type TMDbCrewMember struct {
+	ID   int    `json:"id"` // of the person
+	Name string `json:"name"`
+	Job  string `json:"job"`
+}
+
+// TMDbPersonDetails holds a person's birthday and day of death as YYYY-MM-DD,
+// either of them empty when unknown.
+type TMDbPersonDetails struct {
+	Name     string `json:"name"`
+	Birthday string `json:"birthday"`
+	Deathday string `json:"deathday"`
+}
+
+// MetadataProvider is a source of movie and people metadata in the shape of
+// the TMDb API.
+type MetadataProvider interface {
+	PopularMovies(page int) (*TMDbMovieResult, error)
+	MovieDetails(movieID int) (*TMDbMovieDetails, error)
+	// PersonDetails looks a person up by TMDb ID. It returns empty details
+	// when the person is unknown.
+	PersonDetails(personID int) (*TMDbPersonDetails, error)
+}
+
+// openMetadataProvider returns the provider selected by the configuration.
+func openMetadataProvider(cfg *Config) (MetadataProvider, error) {
+	switch cfg.Metadata.Provider {
+	case "tmdb":
+		return newTMDbProvider(cfg.TMDb), nil
+	case "local":
+		if cfg.Metadata.LocalDir == "" {
+			return nil, fmt.Errorf("the local metadata provider needs a directory (--metadata-dir)")
+		}
+		return &LocalProvider{Dir: cfg.Metadata.LocalDir}, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata provider %q (use tmdb or local)", cfg.Metadata.Provider)
+	}
+}
+
+// endpointGetter returns the response body of a TMDb API endpoint such as
+// "/movie/popular".
+type endpointGetter func(endpoint string, params url.Values) (io.ReadCloser, error)
+
+// TMDbProvider talks to the TMDb HTTP API.
+type TMDbProvider struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func newTMDbProvider(cfg TMDbConfig) *TMDbProvider {
+	return &TMDbProvider{
+		BaseURL: cfg.BaseURL,
+		APIKey:  cfg.APIKey,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *TMDbProvider) get(endpoint string, params url.Values) (io.ReadCloser, error) {
+	query := url.Values{"api_key": {p.APIKey}}
+	for key, values := range params {
+		query[key] = values
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(p.BaseURL + endpoint + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("TMDb returned %s for %s", resp.Status, endpoint)
+	}
+	return resp.Body, nil
+}
+
+func (p *TMDbProvider) PopularMovies(page int) (*TMDbMovieResult, error) {
+	return fetchPopularMovies(p.get, page)
+}
+
+func (p *TMDbProvider) MovieDetails(movieID int) (*TMDbMovieDetails, error) {
+	return fetchMovieDetails(p.get, movieID)
+}
+
+func (p *TMDbProvider) PersonDetails(personID int) (*TMDbPersonDetails, error) {
+	return fetchPersonDetails(p.get, personID)
+}
+
+// LocalProvider serves TMDb-shaped JSON fixtures from a directory, so the
+// catalog can be populated without network access. Each endpoint maps to a
+// file below Dir:
+//
+//	/movie/popular?page=N     movie/popular/N.json
+//	/movie/ID                 movie/ID.json
+//	/person/ID                person/ID.json
+type LocalProvider struct {
+	Dir string
+}
+
+func (p *LocalProvider) get(endpoint string, params url.Values) (io.ReadCloser, error) {
+	file := filepath.Join(p.Dir, filepath.FromSlash(endpoint))
+	if page := params.Get("page"); page != "" {
+		file = filepath.Join(file, page)
+	}
+	return os.Open(file + ".json")
+}
+
+func (p *LocalProvider) PopularMovies(page int) (*TMDbMovieResult, error) {
+	return fetchPopularMovies(p.get, page)
+}
+
+func (p *LocalProvider) MovieDetails(movieID int) (*TMDbMovieDetails, error) {
+	return fetchMovieDetails(p.get, movieID)
+}
+
+func (p *LocalProvider) PersonDetails(personID int) (*TMDbPersonDetails, error) {
+	details, err := fetchPersonDetails(p.get, personID)
+	if os.IsNotExist(err) {
+		// People without a fixture simply have no known birthday
+		return &TMDbPersonDetails{}, nil
+	}
+	return details, err
+}
+
+func fetchPopularMovies(get endpointGetter, page int) (*TMDbMovieResult, error) {
+	body, err := get("/movie/popular", url.Values{"page": {strconv.Itoa(page)}})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var result TMDbMovieResult
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func fetchMovieDetails(get endpointGetter, movieID int) (*TMDbMovieDetails, error) {
+	body, err := get(fmt.Sprintf("/movie/%d", movieID), url.Values{"append_to_response": {"credits"}})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var details struct {
+		Title       string `json:"title"`
+		ReleaseDate string `json:"release_date"`
+		Runtime     int    `json:"runtime"`
+		Genres      []struct {
+			Name string `json:"name"`
+		} `json:"genres"`
+		Credits struct {
+			Crew []TMDbCrewMember `json:"crew"`
+			Cast []TMDbCastMember `json:"cast"`
+		} `json:"credits"`
+	}
+	if err := json.NewDecoder(body).Decode(&details); err != nil {
+		return nil, err
+	}
+
+	// Extract the crew, the director and cast
+	movie := &TMDbMovieDetails{
+		ID:          movieID,
+		Title:       details.Title,
+		ReleaseDate: details.ReleaseDate,
+		Runtime:     details.Runtime,
+		Crew:        details.Credits.Crew,
+		Cast:        details.Credits.Cast,
+	}
+	for _, crew := range details.Credits.Crew {
+		if crew.Job == "Director" {
+			movie.Director = crew
+			break
+		}
+	}
+	for _, genre := range details.Genres {
+		movie.Genres = append(movie.Genres, genre.Name)
+	}
+
+	return movie, nil
+}
+
+func fetchPersonDetails(get endpointGetter, personID int) (*TMDbPersonDetails, error) {
+	if personID == 0 {
+		return &TMDbPersonDetails{}, nil
+	}
+	body, err := get(fmt.Sprintf("/person/%d", personID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var details TMDbPersonDetails
+	if err := json.NewDecoder(body).Decode(&details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
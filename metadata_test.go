@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTMDbStandIn serves the TMDb fixtures the way the TMDb API would,
+// refusing requests without the API key.
+func newTMDbStandIn(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("api_key") != apiKey {
+			http.Error(w, `{"status_message": "Invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/movie/") && r.URL.Path != "/movie/popular" && query.Get("append_to_response") != "credits" {
+			t.Errorf("%s requested without credits", r.URL.Path)
+		}
+		file := filepath.Join("fixtures", "tmdb", filepath.FromSlash(r.URL.Path))
+		if page := query.Get("page"); page != "" {
+			file = filepath.Join(file, page)
+		}
+		data, err := os.ReadFile(file + ".json")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTMDbProvider(t *testing.T) {
+	server := newTMDbStandIn(t, "secret")
+	provider := &TMDbProvider{BaseURL: server.URL, APIKey: "secret", Client: server.Client()}
+
+	popular, err := provider.PopularMovies(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(popular.Results) != 2 || popular.Results[1].ID != 603 || popular.TotalPages != 1 {
+		t.Errorf("PopularMovies = %+v", popular)
+	}
+
+	movie, err := provider.MovieDetails(603)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Title != "The Matrix" || movie.ReleaseDate != "1999-03-30" || movie.Runtime != 136 {
+		t.Errorf("MovieDetails = %+v", movie)
+	}
+	if movie.Director.Name != "Lana Wachowski" || movie.Director.ID != 9340 {
+		t.Errorf("director = %+v; want the first crew member with the Director job", movie.Director)
+	}
+	if len(movie.Cast) < 2 || movie.Cast[0].Name != "Keanu Reeves" || movie.Cast[0].Character != "Neo" || movie.Cast[1].Order != 1 {
+		t.Errorf("cast = %+v", movie.Cast)
+	}
+
+	person, err := provider.PersonDetails(6384)
+	if err != nil || person.Birthday != "1964-09-02" || person.Deathday != "" {
+		t.Errorf("PersonDetails of Keanu Reeves = %+v, %v; want born 1964-09-02 and alive", person, err)
+	}
+}
+
+func TestTMDbProviderErrors(t *testing.T) {
+	server := newTMDbStandIn(t, "secret")
+	provider := &TMDbProvider{BaseURL: server.URL, APIKey: "wrong", Client: server.Client()}
+	if _, err := provider.MovieDetails(603); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("MovieDetails with a bad API key: err = %v; want a 401 error", err)
+	}
+
+	provider.APIKey = "secret"
+	if _, err := provider.MovieDetails(1); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("MovieDetails of an unknown movie: err = %v; want a 404 error", err)
+	}
+
+	requests := 0
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, `{"status_message": "Your request count is over the allowed limit."}`, http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	provider = &TMDbProvider{BaseURL: limited.URL, APIKey: "secret", Client: limited.Client()}
+	if _, err := provider.PopularMovies(1); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("PopularMovies when rate limited: err = %v; want a 429 error", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests made when rate limited; want 1", requests)
+	}
+}
+
+func TestLocalProvider(t *testing.T) {
+	provider := &LocalProvider{Dir: filepath.Join("fixtures", "tmdb")}
+
+	popular, err := provider.PopularMovies(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(popular.Results) != 2 || popular.Results[0].Title != "Inception" {
+		t.Errorf("PopularMovies = %+v", popular)
+	}
+	if _, err := provider.PopularMovies(2); !os.IsNotExist(err) {
+		t.Errorf("PopularMovies past the last page: err = %v; want a missing file", err)
+	}
+
+	movie, err := provider.MovieDetails(27205)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Title != "Inception" || movie.Director.Name == "" || len(movie.Cast) == 0 {
+		t.Errorf("MovieDetails = %+v", movie)
+	}
+
+	if person, err := provider.PersonDetails(6384); err != nil || person.Birthday != "1964-09-02" {
+		t.Errorf("PersonDetails of Keanu Reeves = %+v, %v; want born 1964-09-02", person, err)
+	}
+	if person, err := provider.PersonDetails(1); err != nil || person.Birthday != "" {
+		t.Errorf("PersonDetails of someone without a fixture = %+v, %v; want no birthday", person, err)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is one versioned schema change. Each SQL dialect has its own
+// directory under migrations/ with files named NNNN_description.up.sql and
+// NNNN_description.down.sql.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %q", file)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %q: %w", file, err)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing its up or down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the time each applied migration version ran.
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations row: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// migrateUp applies up to steps pending migrations in version order, or all
+// of them when steps is 0, reporting each one to out. It returns the number
+// of migrations applied.
+func migrateUp(db *sql.DB, dialect string, steps int, out io.Writer) (int, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if steps > 0 && count >= steps {
+			break
+		}
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		err := runMigration(db, dialect, m.up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name)
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+
+		fmt.Fprintf(out, "Applied migration %04d_%s\n", m.version, m.name)
+		count++
+	}
+	return count, nil
+}
+
+// migrateDown reverts the most recently applied migrations, newest first.
+// A steps value of 0 reverts every applied migration.
+func migrateDown(db *sql.DB, dialect string, steps int, out io.Writer) (int, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if steps > 0 && count >= steps {
+			break
+		}
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		err := runMigration(db, dialect, m.down, "DELETE FROM schema_migrations WHERE version = $1", m.version)
+		if err != nil {
+			return count, fmt.Errorf("reverting migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+
+		fmt.Fprintf(out, "Reverted migration %04d_%s\n", m.version, m.name)
+		count++
+	}
+	return count, nil
+}
+
+// createTablePattern finds the tables a migration script creates.
+var createTablePattern = regexp.MustCompile(`(?i)CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+
+// dropSchema drops the tables the migrations create, schema_migrations
+// included, so migrateUp builds the schema afresh. Unlike reverting each
+// migration it cannot be stopped by data an older schema rejects, such as
+// people sharing a name. Other tables in the database are left alone.
+func dropSchema(db *sql.DB, dialect string, out io.Writer) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+
+	// A later migration may add a reference to an earlier table, which
+	// Postgres only lets go of with CASCADE. That drops the foreign keys
+	// pointing at the table, never other tables.
+	drop := "DROP TABLE IF EXISTS %s;\n"
+	if dialect == "postgres" {
+		drop = "DROP TABLE IF EXISTS %s CASCADE;\n"
+	}
+	var script strings.Builder
+	for i := len(migrations) - 1; i >= 0; i-- {
+		for _, match := range createTablePattern.FindAllStringSubmatch(migrations[i].up, -1) {
+			fmt.Fprintf(&script, drop, match[1])
+		}
+	}
+
+	if err := runMigration(db, dialect, script.String(), "DROP TABLE IF EXISTS schema_migrations"); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Dropped the catalog tables")
+	return nil
+}
+
+// runMigration runs a migration script and the statement recording it in one
+// transaction. SQLite can only rebuild a table other tables refer to while
+// foreign keys are not enforced, so enforcement is suspended around the
+// transaction and the references are checked before committing.
+func runMigration(db *sql.DB, dialect, script, record string, args ...interface{}) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if dialect == "sqlite" {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if dialect == "sqlite" {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		err := tx.QueryRow("PRAGMA foreign_key_check").Scan(&table, &rowID, &parent, &fkID)
+		if err == nil {
+			err = fmt.Errorf("table %s is left with broken foreign keys", table)
+		}
+		if err != sql.ErrNoRows {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record the migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+func printMigrationStatus(w io.Writer, db *sql.DB, dialect string) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if appliedAt, ok := applied[m.version]; ok {
+			fmt.Fprintf(w, "%04d_%s  applied %s\n", m.version, m.name, appliedAt.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintf(w, "%04d_%s  pending\n", m.version, m.name)
+		}
+	}
+	return nil
+}
+
+// runMigrateCommand handles `migrate status|up|down [N]`.
+func runMigrateCommand(store MovieStore, args []string) error {
+	s, ok := store.(*sqlStore)
+	if !ok {
+		return fmt.Errorf("the configured database driver has no schema to migrate")
+	}
+	db, dialect := s.db, s.dialect
+
+	if len(args) == 0 || len(args) > 2 {
+		return usageError{"usage: migrate status|up|down [N]"}
+	}
+
+	steps := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return usageError{fmt.Sprintf("invalid number of steps %q", args[1])}
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(os.Stdout, db, dialect)
+	case "up":
+		n, err := migrateUp(db, dialect, steps, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Println("No pending migrations.")
+		}
+		return nil
+	case "down":
+		// Reverting is destructive, so default to a single step.
+		if steps == 0 {
+			steps = 1
+		}
+		n, err := migrateDown(db, dialect, steps, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Println("No applied migrations to revert.")
+		}
+		return nil
+	default:
+		return usageError{fmt.Sprintf("unknown migrate command: %s", args[0])}
+	}
+}
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS people (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE,
+	birth_year INT
+);
+
+CREATE TABLE IF NOT EXISTS movies (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	director_id INT REFERENCES people(id),
+	release_year INT,
+	length_minutes INT,
+	UNIQUE (title, director_id)
+);
+
+CREATE TABLE IF NOT EXISTS movie_actors (
+	movie_id INT REFERENCES movies(id),
+	actor_id INT REFERENCES people(id),
+	PRIMARY KEY (movie_id, actor_id)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE genres (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE TABLE movie_genres (
+	movie_id INT REFERENCES movies(id),
+	genre_id INT REFERENCES genres(id),
+	PRIMARY KEY (movie_id, genre_id)
+);
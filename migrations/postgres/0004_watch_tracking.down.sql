@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS viewings;
+DROP TABLE IF EXISTS watchlist;
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS notes;
+
+-- Only the default profile's data fits the single-user schema
+DELETE FROM ratings WHERE user_id <> (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE ratings DROP CONSTRAINT ratings_pkey;
+ALTER TABLE ratings DROP COLUMN user_id;
+ALTER TABLE ratings ADD PRIMARY KEY (movie_id);
+
+DELETE FROM watchlist WHERE user_id <> (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE watchlist DROP CONSTRAINT watchlist_pkey;
+ALTER TABLE watchlist DROP COLUMN user_id;
+ALTER TABLE watchlist ADD PRIMARY KEY (movie_id);
+
+DELETE FROM viewings WHERE user_id <> (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE viewings DROP COLUMN user_id;
+
+DROP TABLE IF EXISTS users;
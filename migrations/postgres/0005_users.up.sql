@@ -0,0 +1,31 @@
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE
+);
+
+-- Everything recorded before profiles existed belongs to the default profile
+INSERT INTO users (name) VALUES ('default');
+
+ALTER TABLE ratings ADD COLUMN user_id INT REFERENCES users(id);
+UPDATE ratings SET user_id = (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE ratings ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE ratings DROP CONSTRAINT ratings_pkey;
+ALTER TABLE ratings ADD PRIMARY KEY (user_id, movie_id);
+
+ALTER TABLE watchlist ADD COLUMN user_id INT REFERENCES users(id);
+UPDATE watchlist SET user_id = (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE watchlist ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE watchlist DROP CONSTRAINT watchlist_pkey;
+ALTER TABLE watchlist ADD PRIMARY KEY (user_id, movie_id);
+
+ALTER TABLE viewings ADD COLUMN user_id INT REFERENCES users(id);
+UPDATE viewings SET user_id = (SELECT id FROM users WHERE name = 'default');
+ALTER TABLE viewings ALTER COLUMN user_id SET NOT NULL;
+
+CREATE TABLE notes (
+	user_id INT NOT NULL REFERENCES users(id),
+	movie_id INT NOT NULL REFERENCES movies(id),
+	body TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, movie_id)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE credits (
+	movie_id INT REFERENCES movies(id),
+	person_id INT REFERENCES people(id),
+	job VARCHAR(255) NOT NULL,
+	PRIMARY KEY (movie_id, person_id, job)
+);
+
+-- Every movie's director becomes its first crew credit
+INSERT INTO credits (movie_id, person_id, job)
+SELECT id, director_id, 'Director' FROM movies WHERE director_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Who each actor played and their position in the billing, both optional
+ALTER TABLE movie_actors ADD COLUMN character_name VARCHAR(255);
+ALTER TABLE movie_actors ADD COLUMN billing_order INT;
@@ -0,0 +1,9 @@
+-- Fails while several people share a name or a director has several movies
+-- with one title
+DROP INDEX movies_title_director;
+ALTER TABLE movies ADD CONSTRAINT movies_title_director_id_key UNIQUE (title, director_id);
+ALTER TABLE movies DROP COLUMN tmdb_id;
+
+DROP INDEX people_name;
+ALTER TABLE people DROP COLUMN tmdb_id;
+ALTER TABLE people ADD CONSTRAINT people_name_key UNIQUE (name);
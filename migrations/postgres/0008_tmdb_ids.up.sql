@@ -0,0 +1,11 @@
+-- People are told apart by their TMDb ID, so names no longer have to be
+-- unique
+ALTER TABLE people DROP CONSTRAINT people_name_key;
+ALTER TABLE people ADD COLUMN tmdb_id INT UNIQUE;
+CREATE INDEX people_name ON people (name);
+
+-- So are movies: a director may have several movies with one title, such as
+-- remakes, as long as TMDb tells them apart
+ALTER TABLE movies ADD COLUMN tmdb_id INT UNIQUE;
+ALTER TABLE movies DROP CONSTRAINT movies_title_director_id_key;
+CREATE UNIQUE INDEX movies_title_director ON movies (title, director_id) WHERE tmdb_id IS NULL;
@@ -0,0 +1,4 @@
+-- Full dates where known; birth_year and release_year keep the year of them
+ALTER TABLE people ADD COLUMN birth_date DATE;
+ALTER TABLE people ADD COLUMN death_date DATE;
+ALTER TABLE movies ADD COLUMN release_date DATE;
@@ -0,0 +1,17 @@
+-- Who changed which person or movie, and how. Rows outlive the records they
+-- describe, so there are no foreign keys. before_state is NULL for inserts
+-- and after_state for deletes.
+CREATE TABLE audit_log (
+	id SERIAL PRIMARY KEY,
+	user_name VARCHAR(255) NOT NULL,
+	operation VARCHAR(16) NOT NULL,
+	entity VARCHAR(16) NOT NULL,
+	entity_id INT NOT NULL,
+	entity_name VARCHAR(255) NOT NULL,
+	summary TEXT NOT NULL,
+	before_state TEXT,
+	after_state TEXT,
+	recorded_at TIMESTAMP NOT NULL
+);
+CREATE INDEX audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX audit_log_recorded_at ON audit_log (recorded_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_actors;
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS people;
@@ -0,0 +1,6 @@
+CREATE TABLE ratings (
+	movie_id INT PRIMARY KEY REFERENCES movies(id),
+	score INT NOT NULL CHECK (score BETWEEN 1 AND 10),
+	review TEXT,
+	rated_at TIMESTAMP NOT NULL
+);
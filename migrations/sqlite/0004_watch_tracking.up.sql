@@ -0,0 +1,10 @@
+CREATE TABLE watchlist (
+	movie_id INT PRIMARY KEY REFERENCES movies(id),
+	added_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE viewings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	movie_id INT NOT NULL REFERENCES movies(id),
+	watched_on DATE NOT NULL
+);
@@ -0,0 +1,37 @@
+DROP TABLE IF EXISTS notes;
+
+-- Only the default profile's data fits the single-user schema
+CREATE TABLE ratings_old (
+	movie_id INT PRIMARY KEY REFERENCES movies(id),
+	score INT NOT NULL CHECK (score BETWEEN 1 AND 10),
+	review TEXT,
+	rated_at TIMESTAMP NOT NULL
+);
+INSERT INTO ratings_old (movie_id, score, review, rated_at)
+	SELECT movie_id, score, review, rated_at FROM ratings
+	WHERE user_id = (SELECT id FROM users WHERE name = 'default');
+DROP TABLE ratings;
+ALTER TABLE ratings_old RENAME TO ratings;
+
+CREATE TABLE watchlist_old (
+	movie_id INT PRIMARY KEY REFERENCES movies(id),
+	added_at TIMESTAMP NOT NULL
+);
+INSERT INTO watchlist_old (movie_id, added_at)
+	SELECT movie_id, added_at FROM watchlist
+	WHERE user_id = (SELECT id FROM users WHERE name = 'default');
+DROP TABLE watchlist;
+ALTER TABLE watchlist_old RENAME TO watchlist;
+
+CREATE TABLE viewings_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	movie_id INT NOT NULL REFERENCES movies(id),
+	watched_on DATE NOT NULL
+);
+INSERT INTO viewings_old (id, movie_id, watched_on)
+	SELECT id, movie_id, watched_on FROM viewings
+	WHERE user_id = (SELECT id FROM users WHERE name = 'default');
+DROP TABLE viewings;
+ALTER TABLE viewings_old RENAME TO viewings;
+
+DROP TABLE IF EXISTS users;
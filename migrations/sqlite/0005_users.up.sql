@@ -0,0 +1,51 @@
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(255) NOT NULL UNIQUE
+);
+
+-- Everything recorded before profiles existed belongs to the default profile
+INSERT INTO users (name) VALUES ('default');
+
+-- SQLite cannot change a primary key, so the tables are rebuilt
+CREATE TABLE ratings_new (
+	user_id INT NOT NULL REFERENCES users(id),
+	movie_id INT NOT NULL REFERENCES movies(id),
+	score INT NOT NULL CHECK (score BETWEEN 1 AND 10),
+	review TEXT,
+	rated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, movie_id)
+);
+INSERT INTO ratings_new (user_id, movie_id, score, review, rated_at)
+	SELECT (SELECT id FROM users WHERE name = 'default'), movie_id, score, review, rated_at FROM ratings;
+DROP TABLE ratings;
+ALTER TABLE ratings_new RENAME TO ratings;
+
+CREATE TABLE watchlist_new (
+	user_id INT NOT NULL REFERENCES users(id),
+	movie_id INT NOT NULL REFERENCES movies(id),
+	added_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, movie_id)
+);
+INSERT INTO watchlist_new (user_id, movie_id, added_at)
+	SELECT (SELECT id FROM users WHERE name = 'default'), movie_id, added_at FROM watchlist;
+DROP TABLE watchlist;
+ALTER TABLE watchlist_new RENAME TO watchlist;
+
+CREATE TABLE viewings_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INT NOT NULL REFERENCES users(id),
+	movie_id INT NOT NULL REFERENCES movies(id),
+	watched_on DATE NOT NULL
+);
+INSERT INTO viewings_new (id, user_id, movie_id, watched_on)
+	SELECT id, (SELECT id FROM users WHERE name = 'default'), movie_id, watched_on FROM viewings;
+DROP TABLE viewings;
+ALTER TABLE viewings_new RENAME TO viewings;
+
+CREATE TABLE notes (
+	user_id INT NOT NULL REFERENCES users(id),
+	movie_id INT NOT NULL REFERENCES movies(id),
+	body TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, movie_id)
+);
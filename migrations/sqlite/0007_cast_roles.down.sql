@@ -0,0 +1,2 @@
+ALTER TABLE movie_actors DROP COLUMN billing_order;
+ALTER TABLE movie_actors DROP COLUMN character_name;
@@ -0,0 +1,23 @@
+-- Fails while several people share a name or a director has several movies
+-- with one title
+CREATE TABLE movies_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title VARCHAR(255) NOT NULL,
+	director_id INT REFERENCES people(id),
+	release_year INT,
+	length_minutes INT,
+	UNIQUE (title, director_id)
+);
+INSERT INTO movies_old (id, title, director_id, release_year, length_minutes)
+	SELECT id, title, director_id, release_year, length_minutes FROM movies;
+DROP TABLE movies;
+ALTER TABLE movies_old RENAME TO movies;
+
+CREATE TABLE people_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(255) NOT NULL UNIQUE,
+	birth_year INT
+);
+INSERT INTO people_old (id, name, birth_year) SELECT id, name, birth_year FROM people;
+DROP TABLE people;
+ALTER TABLE people_old RENAME TO people;
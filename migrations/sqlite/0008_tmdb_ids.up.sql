@@ -0,0 +1,28 @@
+-- People are told apart by their TMDb ID, so names no longer have to be
+-- unique. SQLite cannot drop a constraint, so the table is rebuilt.
+CREATE TABLE people_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(255) NOT NULL,
+	birth_year INT,
+	tmdb_id INT UNIQUE
+);
+INSERT INTO people_new (id, name, birth_year) SELECT id, name, birth_year FROM people;
+DROP TABLE people;
+ALTER TABLE people_new RENAME TO people;
+CREATE INDEX people_name ON people (name);
+
+-- So are movies: a director may have several movies with one title, such as
+-- remakes, as long as TMDb tells them apart
+CREATE TABLE movies_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title VARCHAR(255) NOT NULL,
+	director_id INT REFERENCES people(id),
+	release_year INT,
+	length_minutes INT,
+	tmdb_id INT UNIQUE
+);
+INSERT INTO movies_new (id, title, director_id, release_year, length_minutes)
+	SELECT id, title, director_id, release_year, length_minutes FROM movies;
+DROP TABLE movies;
+ALTER TABLE movies_new RENAME TO movies;
+CREATE UNIQUE INDEX movies_title_director ON movies (title, director_id) WHERE tmdb_id IS NULL;
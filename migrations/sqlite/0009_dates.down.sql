@@ -0,0 +1,3 @@
+ALTER TABLE movies DROP COLUMN release_date;
+ALTER TABLE people DROP COLUMN death_date;
+ALTER TABLE people DROP COLUMN birth_date;
@@ -0,0 +1,10 @@
+-- Reversible catalog changes for undo and redo. before_state and after_state
+-- hold the touched records on either side of the change as JSON.
+CREATE TABLE journal (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	summary TEXT NOT NULL,
+	before_state TEXT NOT NULL,
+	after_state TEXT NOT NULL,
+	undone BOOLEAN NOT NULL DEFAULT FALSE,
+	recorded_at TIMESTAMP NOT NULL
+);
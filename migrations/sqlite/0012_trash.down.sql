@@ -0,0 +1,3 @@
+-- Whatever is in the trash comes back
+ALTER TABLE movies DROP COLUMN trashed_at;
+ALTER TABLE people DROP COLUMN trashed_at;
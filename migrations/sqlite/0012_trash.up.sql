@@ -0,0 +1,4 @@
+-- Deleted people and movies stay in the trash, with their links, until they
+-- are restored or purged
+ALTER TABLE people ADD COLUMN trashed_at TIMESTAMP;
+ALTER TABLE movies ADD COLUMN trashed_at TIMESTAMP;
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const noteUsage = `usage: n [-d director] <title> [text]
+       n -rm [-d director] <title>
+       n`
+
+// noteCommand implements the `n` command: it shows, sets or with -rm removes
+// the note on a movie found by title, or lists every note without
+// arguments. The director disambiguates equal titles.
+func noteCommand(store MovieStore, args []string) error {
+	fs := newCommandFlagSet("n")
+	remove := fs.Bool("rm", false, "remove the note")
+	director := fs.String("d", "", "director of the movie")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		if *remove || *director != "" {
+			return usageError{noteUsage}
+		}
+		return printNotes(store)
+	}
+	if len(rest) > 2 || (*remove && len(rest) != 1) {
+		return usageError{noteUsage}
+	}
+	movie, err := findMovie(store, rest[0], *director)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *remove:
+		err := store.DeleteNote(movie.ID)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("'%s' has no note", movie.Title)
+		} else if err != nil {
+			return fmt.Errorf("removing note: %w", err)
+		}
+		fmt.Printf("Removed the note on %s.\n", movie.Title)
+
+	case len(rest) == 2:
+		text := strings.TrimSpace(rest[1])
+		if text == "" {
+			return fmt.Errorf("the note cannot be empty; use n -rm to remove it")
+		}
+		if err := store.SetNote(movie.ID, text, time.Now()); err != nil {
+			return fmt.Errorf("saving note: %w", err)
+		}
+		fmt.Printf("Saved the note on %s.\n", movie.Title)
+
+	default:
+		note, err := store.MovieNote(movie.ID)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("'%s' has no note", movie.Title)
+		} else if err != nil {
+			return fmt.Errorf("fetching note: %w", err)
+		}
+		fmt.Printf("%s %s in %d (noted %s):\n", note.Title, byDirector(note.Director), note.ReleaseYear, note.UpdatedAt.Local().Format("2006-01-02"))
+		fmt.Printf("    %s\n", note.Text)
+	}
+	return nil
+}
+
+func printNotes(store MovieStore) error {
+	notes, err := store.Notes()
+	if err != nil {
+		return fmt.Errorf("fetching notes: %w", err)
+	}
+	if len(notes) == 0 {
+		fmt.Println("No notes yet.")
+		return nil
+	}
+
+	for _, n := range notes {
+		fmt.Printf("%s %s in %d (noted %s):\n", n.Title, byDirector(n.Director), n.ReleaseYear, n.UpdatedAt.Local().Format("2006-01-02"))
+		fmt.Printf("    %s\n", n.Text)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrAmbiguousName is returned when a name given to look someone up belongs
+// to several people.
+var ErrAmbiguousName = errors.New("name is ambiguous")
+
+// labelPeople tells namesakes apart by birth year, e.g. "John Smith (b. 1970)",
+// or by ID, e.g. "John Smith (id 42)", when the birth year is unknown or
+// shared. lookupPerson accepts these labels in place of a name.
+func labelPeople(people []Person) map[int]string {
+	byYear := map[int]string{}
+	count := map[string]int{}
+	for _, p := range people {
+		if p.BirthYear > 0 {
+			byYear[p.ID] = fmt.Sprintf("%s (b. %d)", p.Name, p.BirthYear)
+			count[byYear[p.ID]]++
+		}
+	}
+
+	labels := map[int]string{}
+	for _, p := range people {
+		if label, ok := byYear[p.ID]; ok && count[label] == 1 {
+			labels[p.ID] = label
+		} else {
+			labels[p.ID] = fmt.Sprintf("%s (id %d)", p.Name, p.ID)
+		}
+	}
+	return labels
+}
+
+var personLabelSuffix = regexp.MustCompile(`^(.*\S)\s+\((b\.|id)\s*(\d+)\)$`)
+
+// lookupPerson finds the person a name or personLabel refers to. It returns
+// ErrNotFound if there is nobody of that name and ErrAmbiguousName if there
+// are several and the label does not say which one.
+func lookupPerson(store MovieStore, label string) (*Person, error) {
+	return matchPerson(label, store.PeopleByName)
+}
+
+// matchPerson is lookupPerson among the people byName returns.
+func matchPerson(label string, byName func(name string) ([]Person, error)) (*Person, error) {
+	label = strings.TrimSpace(label)
+	name, birthYear, id := label, 0, 0
+	if m := personLabelSuffix.FindStringSubmatch(label); m != nil {
+		name = m[1]
+		n, _ := strconv.Atoi(m[3])
+		if m[2] == "id" {
+			id = n
+		} else {
+			birthYear = n
+		}
+	}
+
+	people, err := byName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 && name != label {
+		// Somebody's actual name may look like a label
+		if people, err = byName(label); err != nil {
+			return nil, err
+		}
+		birthYear, id = 0, 0
+	}
+
+	var matches []Person
+	for _, p := range people {
+		if (birthYear == 0 || p.BirthYear == birthYear) && (id == 0 || p.ID == id) {
+			matches = append(matches, p)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return &matches[0], nil
+	default:
+		labels := labelPeople(matches)
+		var choices []string
+		for _, p := range matches {
+			choices = append(choices, labels[p.ID])
+		}
+		return nil, fmt.Errorf("'%s' %w, use one of: %s", name, ErrAmbiguousName, strings.Join(choices, ", "))
+	}
+}
+
+// personLabels maps the IDs of people who share their name with someone
+// else to their label from labelPeople. Everyone else is shown by name alone.
+type personLabels map[int]string
+
+func loadPersonLabels(store MovieStore) (personLabels, error) {
+	namesakes, err := store.Namesakes()
+	if err != nil {
+		return nil, fmt.Errorf("fetching namesakes: %w", err)
+	}
+	return labelPeople(namesakes), nil
+}
+
+// name returns how to show the person with that ID and name.
+func (l personLabels) name(id int, name string) string {
+	if label, ok := l[id]; ok {
+		return label
+	}
+	return name
+}
+
+// lookupFailure turns a lookupPerson error for a prompt answer into the
+// message shown before asking again and the error a script fails with.
+func lookupFailure(role, label string, err error) (message string, failure error) {
+	if errors.Is(err, ErrAmbiguousName) {
+		return fmt.Sprintf("- %v, try again!", err), err
+	}
+	return fmt.Sprintf("- We could not find '%s', try again!", label), fmt.Errorf("could not find %s '%s'", role, label)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rateUsage = `usage: r [-d director] <title> <score 1-10> [review]
+       r -u [-d director] <title>`
+
+// rateMovie implements the `r` command: it rates a movie found by title, or
+// removes its rating with -u. The director disambiguates equal titles.
+func rateMovie(store MovieStore, args []string) error {
+	fs := newCommandFlagSet("r")
+	unrate := fs.Bool("u", false, "remove the rating")
+	director := fs.String("d", "", "director of the movie")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *unrate {
+		if len(rest) != 1 {
+			return usageError{rateUsage}
+		}
+		movie, err := findMovie(store, rest[0], *director)
+		if err != nil {
+			return err
+		}
+		err = store.UnrateMovie(movie.ID)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("'%s' has no rating", movie.Title)
+		} else if err != nil {
+			return fmt.Errorf("removing rating: %w", err)
+		}
+		fmt.Printf("Removed the rating of %s.\n", movie.Title)
+		return nil
+	}
+
+	if len(rest) < 2 || len(rest) > 3 {
+		return usageError{rateUsage}
+	}
+	score, err := parseScore(rest[1])
+	if err != nil {
+		return err
+	}
+	review := ""
+	if len(rest) == 3 {
+		review = strings.TrimSpace(rest[2])
+	}
+
+	movie, err := findMovie(store, rest[0], *director)
+	if err != nil {
+		return err
+	}
+	if err := store.RateMovie(movie.ID, Rating{Score: score, Review: review, RatedAt: time.Now()}); err != nil {
+		return fmt.Errorf("saving rating: %w", err)
+	}
+	fmt.Printf("Rated %s %d/10.\n", movie.Title, score)
+	return nil
+}
+
+func parseScore(s string) (int, error) {
+	score, err := strconv.Atoi(s)
+	if err != nil || score < 1 || score > 10 {
+		return 0, fmt.Errorf("invalid score %q, expected a number from 1 to 10", s)
+	}
+	return score, nil
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiServer exposes the catalog as a JSON REST API.
+type apiServer struct {
+	store MovieStore
+}
+
+// apiMovie is also the record written by `l --format json|yaml`.
+type apiMovie struct {
+	ID            int         `json:"id" yaml:"id"`
+	Title         string      `json:"title" yaml:"title"`
+	Director      string      `json:"director" yaml:"director"`   // "" once the director is deleted
+	Directors     []string    `json:"directors" yaml:"directors"` // including co-directors
+	ReleaseYear   int         `json:"release_year" yaml:"release_year"`
+	ReleaseDate   string      `json:"release_date,omitempty" yaml:"release_date,omitempty"` // YYYY-MM-DD
+	LengthMinutes int         `json:"length_minutes" yaml:"length_minutes"`
+	Length        string      `json:"length" yaml:"length"`
+	Genres        []string    `json:"genres" yaml:"genres"`
+	Rating        *apiRating  `json:"rating" yaml:"rating"` // null when unrated
+	Crew          []apiCredit `json:"crew,omitempty" yaml:"crew,omitempty"`
+	Cast          []apiCastee `json:"cast,omitempty" yaml:"cast,omitempty"`
+}
+
+type apiCredit struct {
+	ID   int    `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+	Job  string `json:"job" yaml:"job"`
+}
+
+type apiCastee struct {
+	ID        int    `json:"id" yaml:"id"`
+	Name      string `json:"name" yaml:"name"`
+	Character string `json:"character,omitempty" yaml:"character,omitempty"`
+	Order     *int   `json:"order" yaml:"order"` // billing position from 1, null when unknown
+	Age       *int   `json:"age" yaml:"age"`     // at the release, null when the birth year is unknown
+	DeathYear *int   `json:"death_year,omitempty" yaml:"death_year,omitempty"`
+}
+
+type apiRating struct {
+	Score   int    `json:"score" yaml:"score"`
+	Review  string `json:"review,omitempty" yaml:"review,omitempty"`
+	RatedAt string `json:"rated_at" yaml:"rated_at"` // YYYY-MM-DD
+}
+
+type apiPerson struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	BirthYear *int   `json:"birth_year"`
+	BirthDate string `json:"birth_date,omitempty"` // YYYY-MM-DD
+	DeathDate string `json:"death_date,omitempty"`
+}
+
+type apiError struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAPIServer(store MovieStore) *apiServer {
+	return &apiServer{store: store}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movies", s.listMovies)
+	mux.HandleFunc("GET /movies/{id}", s.getMovie)
+	mux.HandleFunc("POST /movies", s.createMovie)
+	mux.HandleFunc("POST /people", s.createPerson)
+	mux.HandleFunc("DELETE /people/{id}", s.deletePerson)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+	return logRequests(mux)
+}
+
+// serve runs the API server until it fails.
+func serve(store MovieStore, addr string) error {
+	log.Printf("Serving the movie catalog API on %s", addr)
+	return http.ListenAndServe(addr, newAPIServer(store).routes())
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.RequestURI())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /movies?title=&director=&actor=&genre=&crew=job=name&min_rating=&watched=&sort=title|length_asc|length_desc|rating_asc|rating_desc
+func (s *apiServer) listMovies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := MovieFilter{OrderBy: "title"}
+
+	for param, target := range map[string]**regexp.Regexp{
+		"title":    &filter.Title,
+		"director": &filter.Director,
+		"actor":    &filter.Actor,
+		"genre":    &filter.Genre,
+	} {
+		pattern := query.Get(param)
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_regex", fmt.Sprintf("invalid regex for %s: %v", param, err))
+			return
+		}
+		*target = re
+	}
+
+	for _, crew := range query["crew"] {
+		if err := addCrewFilter(&filter, crew); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_crew", err.Error())
+			return
+		}
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "", "title":
+	case "length_asc", "length_desc", "rating_asc", "rating_desc":
+		filter.OrderBy = sort
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_sort", "sort must be title, length_asc, length_desc, rating_asc or rating_desc")
+		return
+	}
+
+	if watched := query.Get("watched"); watched != "" {
+		value, err := strconv.ParseBool(watched)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_watched", "watched must be true or false")
+			return
+		}
+		filter.Watched = &value
+	}
+
+	if minRating := query.Get("min_rating"); minRating != "" {
+		score, err := parseScore(minRating)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_min_rating", err.Error())
+			return
+		}
+		filter.MinRating = score
+	}
+
+	movies, err := s.store.ListMovies(filter)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	result := make([]apiMovie, 0, len(movies))
+	for _, m := range movies {
+		result = append(result, toAPIMovie(m))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GET /movies/{id}
+func (s *apiServer) getMovie(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	movie, err := s.store.MovieByID(id)
+	if err == nil && !movie.TrashedAt.IsZero() {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	cast, err := s.store.MovieCast(id, nil)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	credits, err := s.store.MovieCredits(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	result := toAPIMovie(*movie)
+	result.Crew = toAPICrew(credits)
+	result.Cast = toAPICast(cast)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// POST /people {"name": "...", "birth_year": 1970, "birth_date": "1970-05-01", "death_date": "..."}
+// Either birth field may be left out; the dates are optional.
+func (s *apiServer) createPerson(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name      string `json:"name"`
+		BirthYear int    `json:"birth_year"`
+		BirthDate string `json:"birth_date"`
+		DeathDate string `json:"death_date"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_person", "name cannot be empty")
+		return
+	}
+	if body.BirthYear < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_person", "birth_year must be a positive year")
+		return
+	}
+	person := Person{Name: name, BirthYear: body.BirthYear}
+	var err error
+	if body.BirthDate != "" {
+		if person.BirthDate, err = parseDate(body.BirthDate); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_person", "birth_date: "+err.Error())
+			return
+		}
+		if person.BirthYear == 0 {
+			person.BirthYear = person.BirthDate.Year()
+		} else if person.BirthYear != person.BirthDate.Year() {
+			writeError(w, http.StatusBadRequest, "invalid_person", "birth_date is not in birth_year")
+			return
+		}
+	}
+	if body.DeathDate != "" {
+		if person.DeathDate, err = parseDate(body.DeathDate); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_person", "death_date: "+err.Error())
+			return
+		}
+		if person.DeathDate.Year() < person.BirthYear || person.DeathDate.Before(person.BirthDate) {
+			writeError(w, http.StatusBadRequest, "invalid_person", "death_date is before the birth")
+			return
+		}
+	}
+
+	id, err := createPerson(s.store, person)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiPerson{
+		ID:        id,
+		Name:      name,
+		BirthYear: optionalInt(person.BirthYear),
+		BirthDate: formatDate(person.BirthDate),
+		DeathDate: formatDate(person.DeathDate),
+	})
+}
+
+// POST /movies {"title": "...", "length": "hh:mm", "director": "...",
+// "release_year": 1999, "release_date": "1999-03-31", "actors": ["..."], "characters": ["..."], "genres": ["..."]}
+// The actors are in billing order; characters, if given, match them by position.
+func (s *apiServer) createMovie(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title       string   `json:"title"`
+		Length      string   `json:"length"`
+		Director    string   `json:"director"`
+		ReleaseYear int      `json:"release_year"`
+		ReleaseDate string   `json:"release_date"` // optional, may replace release_year
+		Actors      []string `json:"actors"`
+		Characters  []string `json:"characters"`
+		Genres      []string `json:"genres"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	// Validate the input the same way addMovie does
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		writeError(w, http.StatusBadRequest, "invalid_movie", "title cannot be empty")
+		return
+	}
+	lengthMinutes, err := parseLength(body.Length)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_movie", err.Error())
+		return
+	}
+	var released time.Time
+	if body.ReleaseDate != "" {
+		if released, err = parseDate(body.ReleaseDate); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_movie", "release_date: "+err.Error())
+			return
+		}
+		if body.ReleaseYear == 0 {
+			body.ReleaseYear = released.Year()
+		} else if body.ReleaseYear != released.Year() {
+			writeError(w, http.StatusBadRequest, "invalid_movie", "release_date is not in release_year")
+			return
+		}
+	}
+	if body.ReleaseYear <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_movie", "release_year must be a positive year")
+		return
+	}
+	if len(body.Characters) > len(body.Actors) {
+		writeError(w, http.StatusBadRequest, "invalid_movie", "there are more characters than actors")
+		return
+	}
+
+	director, err := lookupPerson(s.store, body.Director)
+	if err == ErrNotFound {
+		writeError(w, http.StatusUnprocessableEntity, "unknown_director", fmt.Sprintf("could not find director '%s'", body.Director))
+		return
+	} else if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	var cast []CastLink
+	for i, name := range body.Actors {
+		actor, err := lookupPerson(s.store, name)
+		if err == ErrNotFound {
+			writeError(w, http.StatusUnprocessableEntity, "unknown_actor", fmt.Sprintf("could not find actor '%s'", name))
+			return
+		} else if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		link := CastLink{ActorID: actor.ID}
+		if i < len(body.Characters) {
+			link.Character = strings.TrimSpace(body.Characters[i])
+		}
+		cast = append(cast, link)
+	}
+
+	id, err := saveNewMovie(s.store, Movie{
+		Title:         title,
+		DirectorID:    director.ID,
+		ReleaseYear:   body.ReleaseYear,
+		ReleaseDate:   released,
+		LengthMinutes: lengthMinutes,
+	}, cast, body.Genres)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	movie, err := s.store.MovieByID(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIMovie(*movie))
+}
+
+// DELETE /people/{id}[?movies=cascade|detach|reassign&to=ID]
+//
+// Directors are only deleted if `movies` says what happens to their movies.
+func (s *apiServer) deletePerson(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	mode := query.Get("movies")
+	switch mode {
+	case "", cascadeMovies, detachMovies, reassignMovies:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_movies", "movies must be cascade, detach or reassign")
+		return
+	}
+	if (mode == reassignMovies) != query.Has("to") {
+		writeError(w, http.StatusBadRequest, "invalid_movies", "to is required with movies=reassign, and only then")
+		return
+	}
+
+	person, err := s.store.PersonByID(id)
+	if err == nil && !person.TrashedAt.IsZero() {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	var to *Person
+	if mode == reassignMovies {
+		toID, err := strconv.Atoi(query.Get("to"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_movies", fmt.Sprintf("invalid director id %q", query.Get("to")))
+			return
+		}
+		if toID == id {
+			writeError(w, http.StatusBadRequest, "invalid_movies", "cannot reassign movies to the person being deleted")
+			return
+		}
+		if to, err = s.store.PersonByID(toID); errors.Is(err, ErrNotFound) || err == nil && !to.TrashedAt.IsZero() {
+			writeError(w, http.StatusUnprocessableEntity, "unknown_director", fmt.Sprintf("could not find director %d", toID))
+			return
+		} else if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	plan, err := planDirectorDeletion(s.store, person, mode, to)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if _, err := deleteDirector(s.store, plan); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toAPIMovie(m MovieListing) apiMovie {
+	var rating *apiRating
+	if m.Rating != nil {
+		rating = &apiRating{Score: m.Rating.Score, Review: m.Rating.Review, RatedAt: m.Rating.RatedAt.Format("2006-01-02")}
+	}
+	return apiMovie{
+		ID:            m.ID,
+		Title:         m.Title,
+		Director:      m.Director,
+		Directors:     directorNames(m.Directors),
+		ReleaseYear:   m.ReleaseYear,
+		ReleaseDate:   formatDate(m.ReleaseDate),
+		LengthMinutes: m.LengthMinutes,
+		Length:        fmt.Sprintf("%02d:%02d", m.LengthMinutes/60, m.LengthMinutes%60),
+		Genres:        append([]string{}, m.Genres...),
+		Rating:        rating,
+	}
+}
+
+// formatDate renders a date as YYYY-MM-DD, or the zero time as "".
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func directorNames(directors []Person) []string {
+	names := []string{}
+	for _, d := range directors {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func toAPICast(cast []CastMember) []apiCastee {
+	result := []apiCastee{}
+	for _, c := range cast {
+		result = append(result, apiCastee{
+			ID:        c.PersonID,
+			Name:      c.Name,
+			Character: c.Character,
+			Order:     optionalInt(c.Order),
+			Age:       optionalInt(c.Age),
+			DeathYear: optionalInt(c.DeathYear),
+		})
+	}
+	return result
+}
+
+func toAPICrew(credits []Credit) []apiCredit {
+	crew := []apiCredit{}
+	for _, c := range credits {
+		crew = append(crew, apiCredit{ID: c.PersonID, Name: c.Name, Job: c.Job})
+	}
+	return crew
+}
+
+// optionalInt maps the zero value to JSON null.
+func optionalInt(v int) *int {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_id", fmt.Sprintf("invalid id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body apiError
+	body.Error.Status = status
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+// writeStoreError maps the catalog's sentinel errors to HTTP statuses.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, ErrAlreadyExists):
+		writeError(w, http.StatusConflict, "already_exists", err.Error())
+	case errors.Is(err, ErrAmbiguousName):
+		writeError(w, http.StatusConflict, "ambiguous_name", err.Error())
+	case errors.Is(err, ErrPersonIsDirector):
+		writeError(w, http.StatusConflict, "person_is_director", err.Error())
+	default:
+		log.Printf("Internal error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal", "internal server error")
+	}
+}
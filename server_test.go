@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a request through the API handler and decodes the JSON
+// response into v unless v is nil.
+func apiRequest(t *testing.T, handler http.Handler, method, target, body string, v interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, target, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// newTestAPI returns the API handler for store with request logging muted.
+func newTestAPI(t *testing.T, store MovieStore) http.Handler {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return newAPIServer(store).routes()
+}
+
+func TestAPIMovies(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		api := newTestAPI(t, store)
+
+		var person apiPerson
+		if code := apiRequest(t, api, "POST", "/people", `{"name": "Ridley Scott", "birth_year": 1937}`, &person); code != http.StatusCreated {
+			t.Fatalf("POST /people = %d", code)
+		}
+		if person.Name != "Ridley Scott" || person.BirthYear == nil || *person.BirthYear != 1937 {
+			t.Errorf("created person = %+v", person)
+		}
+		if code := apiRequest(t, api, "POST", "/people", `{"name": "Sigourney Weaver"}`, &person); code != http.StatusCreated || person.BirthYear != nil {
+			t.Fatalf("POST /people without a birth year = %d, %+v; want 201 and a null birth_year", code, person)
+		}
+		var apiErr apiError
+		if code := apiRequest(t, api, "POST", "/people", `{"name": "Ridley Scott", "birth_year": 1937}`, &apiErr); code != http.StatusConflict || apiErr.Error.Code != "already_exists" {
+			t.Errorf("POST /people of an existing person = %d, %+v; want 409 already_exists", code, apiErr)
+		}
+
+		var movie apiMovie
+		body := `{"title": "Alien", "length": "01:57", "director": "Ridley Scott", "release_year": 1979, "actors": ["Sigourney Weaver"]}`
+		if code := apiRequest(t, api, "POST", "/movies", body, &movie); code != http.StatusCreated {
+			t.Fatalf("POST /movies = %d", code)
+		}
+		if movie.Title != "Alien" || movie.Director != "Ridley Scott" || movie.LengthMinutes != 117 || movie.Length != "01:57" {
+			t.Errorf("created movie = %+v", movie)
+		}
+		body = `{"title": "Prometheus", "length": "02:04", "director": "Nobody", "release_year": 2012}`
+		if code := apiRequest(t, api, "POST", "/movies", body, &apiErr); code != http.StatusUnprocessableEntity || apiErr.Error.Code != "unknown_director" {
+			t.Errorf("POST /movies with an unknown director = %d, %+v; want 422 unknown_director", code, apiErr)
+		}
+		if code := apiRequest(t, api, "POST", "/people", `{"name": "Sigourney Weaver", "birth_year": 1949}`, nil); code != http.StatusCreated {
+			t.Errorf("POST /people of a namesake = %d; want 201", code)
+		}
+		body = `{"title": "Avatar", "length": "02:42", "director": "Ridley Scott", "release_year": 2009, "actors": ["Sigourney Weaver"]}`
+		if code := apiRequest(t, api, "POST", "/movies", body, &apiErr); code != http.StatusConflict || apiErr.Error.Code != "ambiguous_name" {
+			t.Errorf("POST /movies with an ambiguous actor = %d, %+v; want 409 ambiguous_name", code, apiErr)
+		}
+		if code := apiRequest(t, api, "POST", "/movies", `{"title": "Alien", "rating": 5}`, &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "invalid_json" {
+			t.Errorf("POST /movies with an unknown field = %d, %+v; want 400 invalid_json", code, apiErr)
+		}
+
+		var fetched apiMovie
+		if code := apiRequest(t, api, "GET", "/movies/"+strconv.Itoa(movie.ID), "", &fetched); code != http.StatusOK {
+			t.Fatalf("GET /movies/{id} = %d", code)
+		}
+		if len(fetched.Cast) != 1 || fetched.Cast[0].Name != "Sigourney Weaver" || fetched.Cast[0].Age != nil {
+			t.Errorf("cast = %+v; want Sigourney Weaver with a null age", fetched.Cast)
+		}
+		if code := apiRequest(t, api, "GET", "/movies/999", "", &apiErr); code != http.StatusNotFound {
+			t.Errorf("GET /movies/999 = %d; want 404", code)
+		}
+		if code := apiRequest(t, api, "GET", "/movies/abc", "", &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "invalid_id" {
+			t.Errorf("GET /movies/abc = %d, %+v; want 400 invalid_id", code, apiErr)
+		}
+
+		var movies []apiMovie
+		if code := apiRequest(t, api, "GET", "/movies?director=^Ridley", "", &movies); code != http.StatusOK || len(movies) != 1 {
+			t.Errorf("GET /movies?director=^Ridley = %d, %+v; want Alien", code, movies)
+		}
+		if code := apiRequest(t, api, "GET", "/movies?actor=Ford", "", &movies); code != http.StatusOK || len(movies) != 0 {
+			t.Errorf("GET /movies?actor=Ford = %d, %+v; want no movies", code, movies)
+		}
+		if code := apiRequest(t, api, "GET", "/movies?title=(", "", &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "invalid_regex" {
+			t.Errorf("GET /movies?title=( = %d, %+v; want 400 invalid_regex", code, apiErr)
+		}
+		if code := apiRequest(t, api, "GET", "/movies?sort=year", "", &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "invalid_sort" {
+			t.Errorf("GET /movies?sort=year = %d, %+v; want 400 invalid_sort", code, apiErr)
+		}
+	})
+}
+
+func TestAPIDeletePerson(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		api := newTestAPI(t, store)
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		actor := mustAddPerson(t, store, "Sigourney Weaver", 1949)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LinkActor(CastLink{MovieID: movieID, ActorID: actor}); err != nil {
+			t.Fatal(err)
+		}
+
+		var apiErr apiError
+		if code := apiRequest(t, api, "DELETE", "/people/"+strconv.Itoa(director), "", &apiErr); code != http.StatusConflict || apiErr.Error.Code != "person_is_director" {
+			t.Errorf("DELETE of a director = %d, %+v; want 409 person_is_director", code, apiErr)
+		}
+		if code := apiRequest(t, api, "DELETE", "/people/"+strconv.Itoa(actor), "", nil); code != http.StatusNoContent {
+			t.Errorf("DELETE of an actor = %d; want 204", code)
+		}
+		if code := apiRequest(t, api, "DELETE", "/people/"+strconv.Itoa(actor), "", &apiErr); code != http.StatusNotFound {
+			t.Errorf("DELETE of a deleted person = %d; want 404", code)
+		}
+		if code := apiRequest(t, api, "GET", "/nowhere", "", &apiErr); code != http.StatusNotFound || apiErr.Error.Code != "not_found" {
+			t.Errorf("GET /nowhere = %d, %+v; want 404 not_found", code, apiErr)
+		}
+	})
+}
+
+func TestAPIDeleteDirector(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		api := newTestAPI(t, store)
+		ridley := mustAddPerson(t, store, "Ridley Scott", 1937)
+		james := mustAddPerson(t, store, "James Cameron", 1954)
+		other := mustAddPerson(t, store, "Someone Else", 1960)
+		var alien, gladiator int
+		for _, m := range []Movie{
+			{Title: "Alien", DirectorID: ridley, ReleaseYear: 1979},
+			{Title: "Aliens", DirectorID: james, ReleaseYear: 1986},
+			{Title: "Alien", DirectorID: other, ReleaseYear: 2030},
+			{Title: "Gladiator", DirectorID: other, ReleaseYear: 2000},
+		} {
+			id, err := store.AddMovie(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case m.Title == "Alien" && m.DirectorID == ridley:
+				alien = id
+			case m.Title == "Gladiator":
+				gladiator = id
+			}
+		}
+		person := func(id int) string { return "/people/" + strconv.Itoa(id) }
+
+		var apiErr apiError
+		for _, query := range []string{"?movies=forget", "?movies=reassign", "?movies=detach&to=2", "?movies=reassign&to=abc"} {
+			if code := apiRequest(t, api, "DELETE", person(ridley)+query, "", &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "invalid_movies" {
+				t.Errorf("DELETE %s = %d, %+v; want 400 invalid_movies", query, code, apiErr)
+			}
+		}
+		if code := apiRequest(t, api, "DELETE", person(ridley)+"?movies=reassign&to=999", "", &apiErr); code != http.StatusUnprocessableEntity || apiErr.Error.Code != "unknown_director" {
+			t.Errorf("DELETE reassigning to an unknown director = %d, %+v; want 422 unknown_director", code, apiErr)
+		}
+		if code := apiRequest(t, api, "DELETE", person(ridley)+"?movies=reassign&to="+strconv.Itoa(other), "", &apiErr); code != http.StatusConflict || apiErr.Error.Code != "already_exists" {
+			t.Errorf("DELETE reassigning to a director with the same title = %d, %+v; want 409 already_exists", code, apiErr)
+		}
+
+		if code := apiRequest(t, api, "DELETE", person(ridley)+"?movies=reassign&to="+strconv.Itoa(james), "", nil); code != http.StatusNoContent {
+			t.Fatalf("DELETE reassigning the movies = %d; want 204", code)
+		}
+		var movie apiMovie
+		if code := apiRequest(t, api, "GET", "/movies/"+strconv.Itoa(alien), "", &movie); code != http.StatusOK || movie.Director != "James Cameron" {
+			t.Errorf("reassigned movie = %d, %+v; want directed by James Cameron", code, movie)
+		}
+
+		if code := apiRequest(t, api, "DELETE", person(james)+"?movies=detach", "", nil); code != http.StatusNoContent {
+			t.Fatalf("DELETE detaching the movies = %d; want 204", code)
+		}
+		if code := apiRequest(t, api, "GET", "/movies/"+strconv.Itoa(alien), "", &movie); code != http.StatusOK || movie.Director != "" {
+			t.Errorf("detached movie = %d, %+v; want no director", code, movie)
+		}
+
+		if code := apiRequest(t, api, "DELETE", person(other)+"?movies=cascade", "", nil); code != http.StatusNoContent {
+			t.Fatalf("DELETE cascading to the movies = %d; want 204", code)
+		}
+		if code := apiRequest(t, api, "GET", "/movies/"+strconv.Itoa(gladiator), "", &apiErr); code != http.StatusNotFound {
+			t.Errorf("GET of a movie deleted with its director = %d; want 404", code)
+		}
+		var movies []apiMovie
+		if code := apiRequest(t, api, "GET", "/movies", "", &movies); code != http.StatusOK || len(movies) != 2 {
+			t.Errorf("GET /movies after the deletions = %d, %+v; want Alien and Aliens", code, movies)
+		}
+	})
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by a MovieStore when a looked-up record does
+	// not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when an insert would violate a unique key.
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// Person is anyone in the cast or crew. Names are not unique; people from
+// TMDb are identified by their TMDb ID.
+type Person struct {
+	ID        int
+	Name      string
+	BirthYear int       // 0 when unknown; the year of BirthDate when that is known
+	BirthDate time.Time // zero when only the year, or nothing, is known
+	DeathDate time.Time // zero when alive or unknown
+	TMDbID    int       // 0 when not from TMDb
+	TrashedAt time.Time // zero unless in the trash
+}
+
+type Movie struct {
+	ID            int
+	Title         string
+	DirectorID    int
+	ReleaseYear   int
+	ReleaseDate   time.Time // zero when only the year is known
+	LengthMinutes int
+	TMDbID        int       // 0 when not from TMDb
+	TrashedAt     time.Time // zero unless in the trash
+}
+
+// MovieListing is a movie joined with its director's name, as shown by `l`.
+type MovieListing struct {
+	ID            int
+	Title         string
+	DirectorID    int
+	Director      string
+	Directors     []Person // every credited director, Director first
+	ReleaseYear   int
+	ReleaseDate   time.Time // zero when only the year is known
+	LengthMinutes int
+	Genres        []string  // sorted by name
+	Rating        *Rating   // nil when unrated
+	TMDbID        int       // 0 when not from TMDb
+	TrashedAt     time.Time // zero unless in the trash
+}
+
+// Rating is a personal opinion of a movie.
+type Rating struct {
+	Score   int    // 1 to 10
+	Review  string // optional
+	RatedAt time.Time
+}
+
+// CastMember is an actor of a movie together with their role and age at
+// release.
+type CastMember struct {
+	PersonID  int
+	Name      string
+	Age       int    // at the release, 0 when the birth year is unknown
+	BirthYear int    // 0 when unknown
+	DeathYear int    // 0 when alive or unknown
+	Character string // empty when unknown
+	Order     int    // billing position from 1, 0 when unknown
+}
+
+// WatchEntry is a movie on the watchlist or a logged viewing of it.
+type WatchEntry struct {
+	MovieID     int
+	Title       string
+	Director    string
+	ReleaseYear int
+	// Date is when the movie was added to the watchlist, or the day it was
+	// watched.
+	Date time.Time
+}
+
+// Note is a user's free-form note on a movie.
+type Note struct {
+	MovieID     int
+	Title       string
+	Director    string
+	ReleaseYear int
+	Text        string
+	UpdatedAt   time.Time
+}
+
+// Credit is a crew member of a movie and the job they did, e.g. "Director"
+// or "Original Music Composer". A person may have several jobs on a movie.
+type Credit struct {
+	MovieID  int
+	PersonID int
+	Name     string
+	Job      string
+}
+
+// CrewFilter matches movies with a crew member whose job and name match.
+type CrewFilter struct {
+	Job  *regexp.Regexp
+	Name *regexp.Regexp
+}
+
+// CastLink is a row of movie_actors.
+type CastLink struct {
+	MovieID   int
+	ActorID   int
+	Character string // empty when unknown
+	Order     int    // billing position from 1, 0 when unknown
+}
+
+// JournalEntry is a recorded change to the catalog that `undo` can revert.
+// Before and After hold the touched records on either side of the change in
+// the journal's own encoding; the store keeps them as they are.
+type JournalEntry struct {
+	ID         int
+	Summary    string // e.g. "delete person 'Heath Ledger'"
+	Before     string
+	After      string
+	Undone     bool
+	RecordedAt time.Time
+}
+
+// AuditEntry records how one insert, update or delete changed a person or a
+// movie. Before and After are JSON, empty for an insert and a delete
+// respectively.
+type AuditEntry struct {
+	ID         int
+	User       string // the profile that made the change
+	Operation  string // "insert", "update", "delete", "trash" or "restore"
+	Entity     string // "person" or "movie"
+	EntityID   int
+	EntityName string // the name or title, as after the change if it survived
+	Summary    string // the change it was part of, as journaled
+	Before     string
+	After      string
+	RecordedAt time.Time
+}
+
+// AuditFilter selects the entries returned by AuditLog. Zero fields match
+// everything.
+type AuditFilter struct {
+	Entity string         // "person" or "movie"
+	Name   *regexp.Regexp // matched against EntityName
+	Since  time.Time      // inclusive
+	Until  time.Time      // exclusive
+}
+
+// MovieFilter selects and orders the movies returned by ListMovies. Nil
+// regular expressions match everything.
+type MovieFilter struct {
+	Title    *regexp.Regexp
+	Director *regexp.Regexp
+	Actor    *regexp.Regexp
+	Genre    *regexp.Regexp
+	// Crew keeps movies matching every crew filter.
+	Crew []CrewFilter
+	// Watched keeps only watched (true) or never watched (false) movies;
+	// nil keeps all.
+	Watched *bool
+	// MinRating keeps only movies rated at least this score; 0 keeps all.
+	MinRating int
+	// OrderBy is "title", "length_asc", "length_desc", "rating_asc" or
+	// "rating_desc". Unrated movies sort last by rating.
+	OrderBy string
+}
+
+// MovieStore is the storage backend for movies, people and the cast links
+// between them. Ratings, notes, the watchlist and the watch history belong to
+// the current user profile; everything else is shared.
+//
+// People and movies in the trash keep their links but are hidden from every
+// method except those looking them up by ID or TMDb ID and TrashedPeople and
+// TrashedMovies. They still count as taken for titles and TMDb IDs.
+type MovieStore interface {
+	// SwitchUser makes name the current user profile, creating it if needed.
+	SwitchUser(name string) (created bool, err error)
+	CurrentUser() string
+	// Users lists the profile names.
+	Users() ([]string, error)
+
+	// PeopleByName lists everyone with that name, ordered by birth year.
+	PeopleByName(name string) ([]Person, error)
+	PersonByID(id int) (*Person, error)
+	// PersonByTMDbID returns ErrNotFound for people not in the catalog.
+	PersonByTMDbID(tmdbID int) (*Person, error)
+	// Namesakes lists the people who share their name with someone else.
+	Namesakes() ([]Person, error)
+	// AddPerson inserts a person unless someone outside the trash with the
+	// same name and birth year exists, whose ID is returned with
+	// created=false.
+	AddPerson(person Person) (id int, created bool, err error)
+	// UpsertPerson finds the person by TMDb ID or else by a name whose birth
+	// year and TMDb ID do not contradict the given ones, fills in what the
+	// catalog is missing, and inserts the person if there is no match. A
+	// trashed person with the TMDb ID is restored.
+	UpsertPerson(person Person) (id int, created bool, err error)
+	// InsertPerson adds a person even if namesakes exist. It returns
+	// ErrAlreadyExists if the TMDb ID is taken.
+	InsertPerson(person Person) (int, error)
+	// UpdatePerson replaces the name and dates of the person with
+	// person.ID, or returns ErrNotFound. The TMDb ID is kept.
+	UpdatePerson(person Person) error
+	// PutPerson writes the person with person.ID, adding them if they are
+	// not in the catalog. It is how undo and redo bring people back.
+	PutPerson(person Person) error
+	// DeletePerson removes a person together with their cast links and
+	// crew credits for good.
+	DeletePerson(id int) error
+	// TrashPerson moves a person to the trash. It returns ErrNotFound for
+	// unknown or already trashed people.
+	TrashPerson(id int, at time.Time) error
+	// RestorePerson takes a person out of the trash, or returns ErrNotFound
+	// if they are not in it.
+	RestorePerson(id int) error
+	// TrashedPeople lists the people in the trash, latest trashed first.
+	TrashedPeople() ([]Person, error)
+	// CountMoviesDirected counts the movies the person has a director
+	// credit on.
+	CountMoviesDirected(personID int) (int, error)
+	MoviesActedIn(personID int) ([]Movie, error)
+	// PersonMovieIDs lists the movies a person directs, acts in or is
+	// credited on, in ID order.
+	PersonMovieIDs(personID int) ([]int, error)
+
+	// AddMovie returns ErrAlreadyExists if the TMDb ID is taken, or for a
+	// movie without one if the director already has a movie with that title
+	// and no TMDb ID. The director is also given a "Director" credit.
+	AddMovie(movie Movie) (int, error)
+	// UpdateMovie replaces the title, director, release and length of the
+	// movie with movie.ID, moving the "Director" credit along with the
+	// director. It returns ErrNotFound for unknown movies and
+	// ErrAlreadyExists under the same conditions as AddMovie.
+	UpdateMovie(movie Movie) error
+	// PutMovie is PutPerson for a movie's own row; its cast, credits and
+	// genres are left as they are.
+	PutMovie(movie Movie) error
+	// ReassignDirector hands every movie fromID directs or co-directs, apart
+	// from those in the trash, to toID. With toID 0 the movies lose that
+	// director: a co-director takes over, or else the movie is left without
+	// one. It returns ErrAlreadyExists under the same conditions as AddMovie.
+	ReassignDirector(fromID, toID int) error
+	// DeleteMovie removes a movie together with its cast links, credits,
+	// genres and every user's rating, note, watchlist entry and viewings for
+	// good.
+	// It returns ErrNotFound for unknown movies.
+	DeleteMovie(id int) error
+	// TrashMovie, RestoreMovie and TrashedMovies are TrashPerson,
+	// RestorePerson and TrashedPeople for movies. A trashed movie keeps its
+	// ratings, notes, watchlist entries and viewings.
+	TrashMovie(id int, at time.Time) error
+	RestoreMovie(id int) error
+	TrashedMovies() ([]Movie, error)
+	MovieByID(id int) (*MovieListing, error)
+	// MovieByTMDbID returns ErrNotFound for movies not in the catalog.
+	MovieByTMDbID(tmdbID int) (*MovieListing, error)
+	CountMovies() (int, error)
+	ListMovies(filter MovieFilter) ([]MovieListing, error)
+
+	// LinkActor adds an actor to a movie's cast. An existing link keeps its
+	// character and billing order unless the new link sets them.
+	LinkActor(link CastLink) error
+	// UnlinkActor removes an actor from a movie's cast, or returns
+	// ErrNotFound if they are not in it.
+	UnlinkActor(movieID, actorID int) error
+	// MovieCast lists a movie's actors in billing order, optionally
+	// filtered by name. Actors without a billing position come last.
+	MovieCast(movieID int, actor *regexp.Regexp) ([]CastMember, error)
+
+	// AddCredit credits a person with a job on a movie; existing credits
+	// are kept.
+	AddCredit(movieID, personID int, job string) error
+	// RemoveCredit returns ErrNotFound if the person has no such credit.
+	RemoveCredit(movieID, personID int, job string) error
+	// MovieCredits lists a movie's crew ordered by job and name.
+	MovieCredits(movieID int) ([]Credit, error)
+
+	// LinkGenre tags a movie with a genre, creating the genre if needed.
+	LinkGenre(movieID int, genre string) error
+	// UnlinkGenre returns ErrNotFound if the movie lacks the genre.
+	UnlinkGenre(movieID int, genre string) error
+	// MovieGenres returns a movie's genres sorted by name.
+	MovieGenres(movieID int) ([]string, error)
+
+	// People, Movies, CastLinks and Credits return whole tables in ID
+	// order, for exporting the catalog.
+	People() ([]Person, error)
+	Movies() ([]Movie, error)
+	CastLinks() ([]CastLink, error)
+	Credits() ([]Credit, error)
+
+	// RateMovie sets a movie's rating, replacing any earlier one.
+	RateMovie(movieID int, rating Rating) error
+	// UnrateMovie returns ErrNotFound if the movie has no rating.
+	UnrateMovie(movieID int) error
+
+	// SetNote sets the note on a movie, replacing any earlier one.
+	SetNote(movieID int, text string, updatedAt time.Time) error
+	// DeleteNote returns ErrNotFound if the movie has no note.
+	DeleteNote(movieID int) error
+	// MovieNote returns ErrNotFound if the movie has no note.
+	MovieNote(movieID int) (*Note, error)
+	// Notes lists the notes by movie title.
+	Notes() ([]Note, error)
+
+	// AddToWatchlist reports added=false if the movie is already on it.
+	AddToWatchlist(movieID int, addedAt time.Time) (added bool, err error)
+	// RemoveFromWatchlist returns ErrNotFound if the movie is not on it.
+	RemoveFromWatchlist(movieID int) error
+	// Watchlist lists the watchlist, oldest entry first.
+	Watchlist() ([]WatchEntry, error)
+	LogViewing(movieID int, watchedOn time.Time) error
+	// Viewings lists the watch history, most recent first.
+	Viewings() ([]WatchEntry, error)
+
+	// RecordChange appends a change to the journal and forgets the undone
+	// ones, which can no longer be redone.
+	RecordChange(entry JournalEntry) error
+	// NextChange returns the change `undo` reverts, the latest one not
+	// undone, or with undone=true the one `redo` reapplies, the earliest
+	// undone one. It returns ErrNotFound if there is none.
+	NextChange(undone bool) (*JournalEntry, error)
+	// MarkChange records whether a change is undone.
+	MarkChange(id int, undone bool) error
+	// Changes lists the whole journal, oldest change first.
+	Changes() ([]JournalEntry, error)
+	// ForgetChange drops a change from the journal so it can be neither
+	// undone nor redone, or returns ErrNotFound.
+	ForgetChange(id int) error
+
+	// RecordAudit appends an entry to the audit log.
+	RecordAudit(entry AuditEntry) error
+	// AuditLog lists the matching audit entries, oldest first.
+	AuditLog(filter AuditFilter) ([]AuditEntry, error)
+
+	// Atomically runs fn against a store whose changes are kept only if fn
+	// returns nil. Use the store passed to fn, not the receiver, inside fn.
+	Atomically(fn func(tx MovieStore) error) error
+
+	Close() error
+}
+
+// openStore opens the storage backend selected by the configuration.
+func openStore(cfg DatabaseConfig) (MovieStore, error) {
+	switch cfg.Driver {
+	case "postgres":
+		return newPostgresStore(cfg.URL)
+	case "sqlite":
+		return newSQLiteStore(cfg.URL)
+	case "memory":
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (use postgres, sqlite or memory)", cfg.Driver)
+	}
+}
+
+// upsertMatch picks the person UpsertPerson updates from the candidates
+// sharing p's name or TMDb ID, or returns nil.
+func upsertMatch(candidates []Person, p Person) *Person {
+	if p.TMDbID != 0 {
+		for i := range candidates {
+			if candidates[i].TMDbID == p.TMDbID {
+				return &candidates[i]
+			}
+		}
+	}
+	for i := range candidates {
+		c := &candidates[i]
+		if c.Name != p.Name {
+			continue
+		}
+		if p.TMDbID != 0 && c.TMDbID != 0 && c.TMDbID != p.TMDbID {
+			continue
+		}
+		if p.BirthYear != 0 && c.BirthYear != 0 && c.BirthYear != p.BirthYear {
+			continue
+		}
+		return c
+	}
+	return nil
+}
+
+// ageAt returns how old p was when m was released, or 0 if either year is
+// unknown. It is exact when both full dates are known; from the years alone it
+// may be one too high. Someone who died before the release gets their age at
+// death.
+func ageAt(p Person, m Movie) int {
+	if p.BirthYear <= 0 || m.ReleaseYear <= 0 {
+		return 0
+	}
+	year, on := m.ReleaseYear, m.ReleaseDate
+	if died := p.DeathDate; !died.IsZero() && (died.Year() < year || !on.IsZero() && died.Before(on)) {
+		year, on = died.Year(), died
+	}
+
+	age := year - p.BirthYear
+	born := p.BirthDate
+	if !born.IsZero() && !on.IsZero() && (on.Month() < born.Month() || on.Month() == born.Month() && on.Day() < born.Day()) {
+		age-- // no birthday yet that year
+	}
+	return age
+}
+
+// castMember describes p's part in m as listed by MovieCast.
+func castMember(p Person, m Movie, character string, order int) CastMember {
+	c := CastMember{
+		PersonID:  p.ID,
+		Name:      p.Name,
+		Age:       ageAt(p, m),
+		BirthYear: p.BirthYear,
+		Character: character,
+		Order:     order,
+	}
+	if !p.DeathDate.IsZero() {
+		c.DeathYear = p.DeathDate.Year()
+	}
+	return c
+}
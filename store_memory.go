@@ -0,0 +1,1444 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a MovieStore that keeps everything in process memory. It is
+// handy on machines without a database server and loses its data on exit.
+type memoryStore struct {
+	mu   sync.Locker
+	user string // current user profile
+	memoryData
+}
+
+// memoryData is the catalog itself, kept apart so Atomically can snapshot it.
+type memoryData struct {
+	people    map[int]*Person
+	movies    map[int]*Movie
+	cast      []castLink
+	credits   []credit
+	genres    map[int][]string // movie ID -> sorted genre names
+	users     map[string]bool
+	ratings   map[userMovie]Rating
+	notes     map[userMovie]Note
+	watchlist map[userMovie]time.Time // -> added at
+	viewings  []viewing
+	journal   []JournalEntry // in ID order
+	audit     []AuditEntry   // in ID order
+	nextID    int
+}
+
+type castLink struct {
+	movieID   int
+	actorID   int
+	character string
+	order     int
+}
+
+type credit struct {
+	movieID  int
+	personID int
+	job      string
+}
+
+// userMovie keys the per-user data of a movie.
+type userMovie struct {
+	user    string
+	movieID int
+}
+
+type viewing struct {
+	user      string
+	movieID   int
+	watchedOn time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{mu: &sync.Mutex{}, memoryData: memoryData{
+		people:    map[int]*Person{},
+		movies:    map[int]*Movie{},
+		genres:    map[int][]string{},
+		users:     map[string]bool{},
+		ratings:   map[userMovie]Rating{},
+		notes:     map[userMovie]Note{},
+		watchlist: map[userMovie]time.Time{},
+	}}
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// Atomically runs fn against a copy of the catalog that replaces it if fn
+// succeeds. The store stays locked meanwhile, so other callers wait for fn
+// rather than lose their writes when it fails.
+func (s *memoryStore) Atomically(fn func(tx MovieStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryStore{mu: noLock{}, user: s.user, memoryData: s.memoryData.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.memoryData = tx.memoryData
+	return nil
+}
+
+// noLock is the lock of the store passed to fn by Atomically, whose caller
+// already holds the real one.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// clone returns a deep copy of the data.
+func (d *memoryData) clone() memoryData {
+	c := memoryData{
+		people:    make(map[int]*Person, len(d.people)),
+		movies:    make(map[int]*Movie, len(d.movies)),
+		cast:      append([]castLink(nil), d.cast...),
+		credits:   append([]credit(nil), d.credits...),
+		genres:    make(map[int][]string, len(d.genres)),
+		users:     make(map[string]bool, len(d.users)),
+		ratings:   make(map[userMovie]Rating, len(d.ratings)),
+		notes:     make(map[userMovie]Note, len(d.notes)),
+		watchlist: make(map[userMovie]time.Time, len(d.watchlist)),
+		viewings:  append([]viewing(nil), d.viewings...),
+		journal:   append([]JournalEntry(nil), d.journal...),
+		audit:     append([]AuditEntry(nil), d.audit...),
+		nextID:    d.nextID,
+	}
+	for id, p := range d.people {
+		saved := *p
+		c.people[id] = &saved
+	}
+	for id, m := range d.movies {
+		saved := *m
+		c.movies[id] = &saved
+	}
+	for id, g := range d.genres {
+		c.genres[id] = append([]string(nil), g...)
+	}
+	for name := range d.users {
+		c.users[name] = true
+	}
+	for key, r := range d.ratings {
+		c.ratings[key] = r
+	}
+	for key, n := range d.notes {
+		c.notes[key] = n
+	}
+	for key, t := range d.watchlist {
+		c.watchlist[key] = t
+	}
+	return c
+}
+
+func (s *memoryStore) SwitchUser(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := !s.users[name]
+	s.users[name] = true
+	s.user = name
+	return created, nil
+}
+
+func (s *memoryStore) CurrentUser() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.user
+}
+
+func (s *memoryStore) Users() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]string, 0, len(s.users))
+	for name := range s.users {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (s *memoryStore) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// sortedPeople returns copies of the people matching keep, ordered by ID.
+func (s *memoryStore) sortedPeople(keep func(p *Person) bool) []Person {
+	var people []Person
+	for _, p := range s.people {
+		if keep(p) {
+			people = append(people, *p)
+		}
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+	return people
+}
+
+// trashedPerson reports whether the person is missing or in the trash.
+func (s *memoryStore) trashedPerson(id int) bool {
+	p, ok := s.people[id]
+	return !ok || !p.TrashedAt.IsZero()
+}
+
+// trashedMovie is trashedPerson for movies.
+func (s *memoryStore) trashedMovie(id int) bool {
+	m, ok := s.movies[id]
+	return !ok || !m.TrashedAt.IsZero()
+}
+
+// byBirthYear orders people by birth year, unknown years last.
+func byBirthYear(people []Person) {
+	sort.SliceStable(people, func(i, j int) bool {
+		a, b := people[i].BirthYear, people[j].BirthYear
+		if (a == 0) != (b == 0) {
+			return b == 0
+		}
+		return a < b
+	})
+}
+
+func (s *memoryStore) PeopleByName(name string) ([]Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	people := s.sortedPeople(func(p *Person) bool { return p.Name == name && p.TrashedAt.IsZero() })
+	byBirthYear(people)
+	return people, nil
+}
+
+func (s *memoryStore) Namesakes() ([]Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := map[string]int{}
+	for _, p := range s.people {
+		if p.TrashedAt.IsZero() {
+			count[p.Name]++
+		}
+	}
+	people := s.sortedPeople(func(p *Person) bool { return p.TrashedAt.IsZero() && count[p.Name] > 1 })
+	byBirthYear(people)
+	sort.SliceStable(people, func(i, j int) bool { return people[i].Name < people[j].Name })
+	return people, nil
+}
+
+func (s *memoryStore) PersonByID(id int) (*Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.people[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *p
+	return &found, nil
+}
+
+func (s *memoryStore) PersonByTMDbID(tmdbID int) (*Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.people {
+		if p.TMDbID == tmdbID {
+			found := *p
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) AddPerson(person Person) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.people {
+		if p.Name == person.Name && p.BirthYear == person.BirthYear && p.TrashedAt.IsZero() {
+			return p.ID, false, nil
+		}
+	}
+	person.ID, person.TMDbID = s.newID(), 0
+	s.people[person.ID] = &person
+	return person.ID, true, nil
+}
+
+func (s *memoryStore) UpsertPerson(person Person) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates := s.sortedPeople(func(p *Person) bool {
+		return (p.Name == person.Name && p.TrashedAt.IsZero()) || (person.TMDbID != 0 && p.TMDbID == person.TMDbID)
+	})
+	match := upsertMatch(candidates, person)
+	if match == nil {
+		person.ID = s.newID()
+		s.people[person.ID] = &person
+		return person.ID, true, nil
+	}
+
+	// Keep what the catalog knows unless TMDb says otherwise
+	p := s.people[match.ID]
+	p.Name = person.Name
+	if person.BirthYear != 0 {
+		p.BirthYear = person.BirthYear
+	}
+	if !person.BirthDate.IsZero() {
+		p.BirthDate = person.BirthDate
+	}
+	if !person.DeathDate.IsZero() {
+		p.DeathDate = person.DeathDate
+	}
+	if person.TMDbID != 0 {
+		p.TMDbID = person.TMDbID
+	}
+	p.TrashedAt = time.Time{}
+	return p.ID, false, nil
+}
+
+func (s *memoryStore) InsertPerson(person Person) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if person.TMDbID != 0 {
+		for _, p := range s.people {
+			if p.TMDbID == person.TMDbID {
+				return 0, fmt.Errorf("person with TMDb ID %d %w", person.TMDbID, ErrAlreadyExists)
+			}
+		}
+	}
+	person.ID = s.newID()
+	s.people[person.ID] = &person
+	return person.ID, nil
+}
+
+func (s *memoryStore) PutPerson(person Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.people {
+		if p.ID != person.ID && person.TMDbID != 0 && p.TMDbID == person.TMDbID {
+			return fmt.Errorf("person '%s' %w", person.Name, ErrAlreadyExists)
+		}
+	}
+	s.people[person.ID] = &person
+	if person.ID > s.nextID {
+		s.nextID = person.ID
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdatePerson(person Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.people[person.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	p.Name, p.BirthYear = person.Name, person.BirthYear
+	p.BirthDate, p.DeathDate = person.BirthDate, person.DeathDate
+	return nil
+}
+
+func (s *memoryStore) DeletePerson(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.movies {
+		if m.DirectorID == id {
+			return fmt.Errorf("person %d still directs %q", id, m.Title)
+		}
+	}
+
+	kept := s.cast[:0]
+	for _, link := range s.cast {
+		if link.actorID != id {
+			kept = append(kept, link)
+		}
+	}
+	s.cast = kept
+
+	keptCredits := s.credits[:0]
+	for _, c := range s.credits {
+		if c.personID != id {
+			keptCredits = append(keptCredits, c)
+		}
+	}
+	s.credits = keptCredits
+	delete(s.people, id)
+	return nil
+}
+
+func (s *memoryStore) TrashPerson(id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.trashedPerson(id) {
+		return ErrNotFound
+	}
+	s.people[id].TrashedAt = at.UTC()
+	return nil
+}
+
+func (s *memoryStore) RestorePerson(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.people[id]
+	if !ok || p.TrashedAt.IsZero() {
+		return ErrNotFound
+	}
+	p.TrashedAt = time.Time{}
+	return nil
+}
+
+func (s *memoryStore) TrashedPeople() ([]Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	people := s.sortedPeople(func(p *Person) bool { return !p.TrashedAt.IsZero() })
+	sort.SliceStable(people, func(i, j int) bool { return people[i].TrashedAt.After(people[j].TrashedAt) })
+	return people, nil
+}
+
+func (s *memoryStore) PersonMovieIDs(personID int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[int]bool{}
+	for _, m := range s.movies {
+		if m.DirectorID == personID {
+			seen[m.ID] = true
+		}
+	}
+	for _, link := range s.cast {
+		if link.actorID == personID {
+			seen[link.movieID] = true
+		}
+	}
+	for _, c := range s.credits {
+		if c.personID == personID {
+			seen[c.movieID] = true
+		}
+	}
+
+	var ids []int
+	for id := range seen {
+		if !s.trashedMovie(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *memoryStore) CountMoviesDirected(personID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, c := range s.credits {
+		if c.personID == personID && c.job == "Director" && !s.trashedMovie(c.movieID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryStore) MoviesActedIn(personID int) ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var movies []Movie
+	for _, link := range s.cast {
+		if link.actorID == personID && !s.trashedMovie(link.movieID) {
+			movies = append(movies, *s.movies[link.movieID])
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool {
+		if movies[i].ReleaseYear != movies[j].ReleaseYear {
+			return movies[i].ReleaseYear < movies[j].ReleaseYear
+		}
+		return movies[i].Title < movies[j].Title
+	})
+	return movies, nil
+}
+
+func (s *memoryStore) AddMovie(movie Movie) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.people[movie.DirectorID]; !ok && movie.DirectorID != 0 {
+		return 0, fmt.Errorf("director %d does not exist", movie.DirectorID)
+	}
+	for _, m := range s.movies {
+		if sameMovie(m, &movie) {
+			return 0, fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+		}
+	}
+	movie.ID = s.newID()
+	s.movies[movie.ID] = &movie
+	if movie.DirectorID != 0 {
+		s.credits = append(s.credits, credit{movieID: movie.ID, personID: movie.DirectorID, job: "Director"})
+	}
+	return movie.ID, nil
+}
+
+// sameMovie mirrors the SQL unique keys: the TMDb ID, and for movies
+// without one the title and director, where no director is unlike any
+// other.
+func sameMovie(a, b *Movie) bool {
+	if a.TMDbID != 0 || b.TMDbID != 0 {
+		return a.TMDbID == b.TMDbID
+	}
+	return a.Title == b.Title && a.DirectorID == b.DirectorID && a.DirectorID != 0
+}
+
+func (s *memoryStore) PutMovie(movie Movie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.people[movie.DirectorID]; !ok && movie.DirectorID != 0 {
+		return fmt.Errorf("director %d does not exist", movie.DirectorID)
+	}
+	for _, m := range s.movies {
+		if m.ID != movie.ID && sameMovie(m, &movie) {
+			return fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+		}
+	}
+	s.movies[movie.ID] = &movie
+	if movie.ID > s.nextID {
+		s.nextID = movie.ID
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateMovie(movie Movie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[movie.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.people[movie.DirectorID]; !ok && movie.DirectorID != 0 {
+		return fmt.Errorf("director %d does not exist", movie.DirectorID)
+	}
+	// The TMDb ID is kept
+	edited := Movie{Title: movie.Title, DirectorID: movie.DirectorID, TMDbID: m.TMDbID}
+	for _, other := range s.movies {
+		if other.ID != movie.ID && sameMovie(other, &edited) {
+			return fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+		}
+	}
+
+	if m.DirectorID != movie.DirectorID {
+		old := credit{movieID: m.ID, personID: m.DirectorID, job: "Director"}
+		moved := credit{movieID: m.ID, personID: movie.DirectorID, job: "Director"}
+		kept := s.credits[:0]
+		for _, c := range s.credits {
+			if c != old && c != moved {
+				kept = append(kept, c)
+			}
+		}
+		s.credits = kept
+		if movie.DirectorID != 0 {
+			s.credits = append(s.credits, moved)
+		}
+	}
+	m.Title, m.DirectorID = movie.Title, movie.DirectorID
+	m.ReleaseYear, m.ReleaseDate = movie.ReleaseYear, movie.ReleaseDate
+	m.LengthMinutes = movie.LengthMinutes
+	return nil
+}
+
+func (s *memoryStore) ReassignDirector(fromID, toID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.people[toID]; !ok && toID != 0 {
+		return fmt.Errorf("director %d does not exist", toID)
+	}
+
+	// Work out the new directors before changing anything, so a title
+	// clash leaves the catalog as it was
+	directorIDs := map[int]int{}
+	for _, m := range s.movies {
+		if m.DirectorID != fromID || !m.TrashedAt.IsZero() {
+			continue
+		}
+		directorIDs[m.ID] = toID
+		if toID != 0 {
+			continue
+		}
+		for _, c := range s.credits {
+			if c.movieID == m.ID && c.job == "Director" && c.personID != fromID && (directorIDs[m.ID] == 0 || c.personID < directorIDs[m.ID]) {
+				directorIDs[m.ID] = c.personID
+			}
+		}
+	}
+	for id, directorID := range directorIDs {
+		if directorID == 0 {
+			continue
+		}
+		reassigned := Movie{Title: s.movies[id].Title, DirectorID: directorID, TMDbID: s.movies[id].TMDbID}
+		for _, other := range s.movies {
+			otherDirectorID, moved := directorIDs[other.ID]
+			if !moved {
+				otherDirectorID = other.DirectorID
+			}
+			if other.ID != id && sameMovie(&reassigned, &Movie{Title: other.Title, DirectorID: otherDirectorID, TMDbID: other.TMDbID}) {
+				return fmt.Errorf("a movie by the new director %w", ErrAlreadyExists)
+			}
+		}
+	}
+
+	for id, directorID := range directorIDs {
+		s.movies[id].DirectorID = directorID
+	}
+	kept := s.credits[:0]
+	var moved []credit
+	for _, c := range s.credits {
+		if c.personID != fromID || c.job != "Director" || s.trashedMovie(c.movieID) {
+			kept = append(kept, c)
+		} else if toID != 0 {
+			moved = append(moved, credit{movieID: c.movieID, personID: toID, job: "Director"})
+		}
+	}
+	for _, c := range moved {
+		if !hasCredit(kept, c) {
+			kept = append(kept, c)
+		}
+	}
+	s.credits = kept
+	return nil
+}
+
+// hasCredit reports whether the credit is in credits.
+func hasCredit(credits []credit, c credit) bool {
+	for _, other := range credits {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) DeleteMovie(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[id]; !ok {
+		return ErrNotFound
+	}
+
+	kept := s.cast[:0]
+	for _, link := range s.cast {
+		if link.movieID != id {
+			kept = append(kept, link)
+		}
+	}
+	s.cast = kept
+
+	keptCredits := s.credits[:0]
+	for _, c := range s.credits {
+		if c.movieID != id {
+			keptCredits = append(keptCredits, c)
+		}
+	}
+	s.credits = keptCredits
+
+	for key := range s.ratings {
+		if key.movieID == id {
+			delete(s.ratings, key)
+		}
+	}
+	for key := range s.notes {
+		if key.movieID == id {
+			delete(s.notes, key)
+		}
+	}
+	for key := range s.watchlist {
+		if key.movieID == id {
+			delete(s.watchlist, key)
+		}
+	}
+	keptViewings := s.viewings[:0]
+	for _, v := range s.viewings {
+		if v.movieID != id {
+			keptViewings = append(keptViewings, v)
+		}
+	}
+	s.viewings = keptViewings
+
+	delete(s.genres, id)
+	delete(s.movies, id)
+	return nil
+}
+
+func (s *memoryStore) TrashMovie(id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.trashedMovie(id) {
+		return ErrNotFound
+	}
+	s.movies[id].TrashedAt = at.UTC()
+	return nil
+}
+
+func (s *memoryStore) RestoreMovie(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok || m.TrashedAt.IsZero() {
+		return ErrNotFound
+	}
+	m.TrashedAt = time.Time{}
+	return nil
+}
+
+func (s *memoryStore) TrashedMovies() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var movies []Movie
+	for _, m := range s.movies {
+		if !m.TrashedAt.IsZero() {
+			movies = append(movies, *m)
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool {
+		if !movies[i].TrashedAt.Equal(movies[j].TrashedAt) {
+			return movies[i].TrashedAt.After(movies[j].TrashedAt)
+		}
+		return movies[i].ID < movies[j].ID
+	})
+	return movies, nil
+}
+
+func (s *memoryStore) MovieByID(id int) (*MovieListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.listing(m), nil
+}
+
+func (s *memoryStore) MovieByTMDbID(tmdbID int) (*MovieListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.movies {
+		if m.TMDbID == tmdbID {
+			return s.listing(m), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) listing(m *Movie) *MovieListing {
+	return &MovieListing{
+		ID:            m.ID,
+		Title:         m.Title,
+		DirectorID:    m.DirectorID,
+		Director:      s.directorName(m),
+		Directors:     s.directors(m),
+		ReleaseYear:   m.ReleaseYear,
+		ReleaseDate:   m.ReleaseDate,
+		LengthMinutes: m.LengthMinutes,
+		Genres:        append([]string(nil), s.genres[m.ID]...),
+		Rating:        s.rating(m.ID),
+		TMDbID:        m.TMDbID,
+		TrashedAt:     m.TrashedAt,
+	}
+}
+
+// directors lists the movie's credited directors outside the trash, the one
+// in the movie first.
+func (s *memoryStore) directors(m *Movie) []Person {
+	var directors []Person
+	for _, c := range s.credits {
+		if c.movieID == m.ID && c.job == "Director" && !s.trashedPerson(c.personID) {
+			directors = append(directors, *s.people[c.personID])
+		}
+	}
+	sort.Slice(directors, func(i, j int) bool {
+		if first := directors[i].ID == m.DirectorID; first != (directors[j].ID == m.DirectorID) {
+			return first
+		}
+		return directors[i].Name < directors[j].Name
+	})
+	return directors
+}
+
+// directorName returns the name of the movie's director, or "" when it has
+// none.
+func (s *memoryStore) directorName(m *Movie) string {
+	if director, ok := s.people[m.DirectorID]; ok {
+		return director.Name
+	}
+	return ""
+}
+
+// rating returns a copy of the movie's rating, or nil.
+func (s *memoryStore) rating(movieID int) *Rating {
+	r, ok := s.ratings[userMovie{s.user, movieID}]
+	if !ok {
+		return nil
+	}
+	return &r
+}
+
+func (s *memoryStore) CountMovies() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, m := range s.movies {
+		if m.TrashedAt.IsZero() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryStore) ListMovies(filter MovieFilter) ([]MovieListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var movies []MovieListing
+	for _, m := range s.movies {
+		if !m.TrashedAt.IsZero() {
+			continue
+		}
+		if filter.Title != nil && !filter.Title.MatchString(m.Title) {
+			continue
+		}
+		directors := s.directors(m)
+		if filter.Director != nil && !anyNameMatches(filter.Director, directors) {
+			continue
+		}
+		if !s.matchesCrew(m.ID, filter.Crew) {
+			continue
+		}
+		if filter.Actor != nil && !s.hasActorMatching(m.ID, filter.Actor) {
+			continue
+		}
+		if filter.Genre != nil && !s.hasGenreMatching(m.ID, filter.Genre) {
+			continue
+		}
+		if filter.Watched != nil && s.watched(m.ID) != *filter.Watched {
+			continue
+		}
+		rating := s.rating(m.ID)
+		if filter.MinRating > 0 && (rating == nil || rating.Score < filter.MinRating) {
+			continue
+		}
+		movies = append(movies, MovieListing{
+			ID:            m.ID,
+			Title:         m.Title,
+			DirectorID:    m.DirectorID,
+			Director:      s.directorName(m),
+			Directors:     directors,
+			ReleaseYear:   m.ReleaseYear,
+			ReleaseDate:   m.ReleaseDate,
+			LengthMinutes: m.LengthMinutes,
+			Genres:        append([]string(nil), s.genres[m.ID]...),
+			Rating:        rating,
+			TMDbID:        m.TMDbID,
+		})
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		a, b := movies[i], movies[j]
+		switch filter.OrderBy {
+		case "length_asc":
+			if a.LengthMinutes != b.LengthMinutes {
+				return a.LengthMinutes < b.LengthMinutes
+			}
+		case "length_desc":
+			if a.LengthMinutes != b.LengthMinutes {
+				return a.LengthMinutes > b.LengthMinutes
+			}
+		case "rating_asc", "rating_desc":
+			if (a.Rating == nil) != (b.Rating == nil) {
+				return b.Rating == nil
+			}
+			if a.Rating != nil && a.Rating.Score != b.Rating.Score {
+				if filter.OrderBy == "rating_asc" {
+					return a.Rating.Score < b.Rating.Score
+				}
+				return a.Rating.Score > b.Rating.Score
+			}
+		}
+		return a.Title < b.Title
+	})
+	return movies, nil
+}
+
+func (s *memoryStore) hasActorMatching(movieID int, actor *regexp.Regexp) bool {
+	for _, link := range s.cast {
+		if link.movieID == movieID && !s.trashedPerson(link.actorID) && actor.MatchString(s.people[link.actorID].Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCrew reports whether every crew filter matches a credit of the
+// movie.
+func (s *memoryStore) matchesCrew(movieID int, filters []CrewFilter) bool {
+	for _, f := range filters {
+		found := false
+		for _, c := range s.credits {
+			if c.movieID != movieID || s.trashedPerson(c.personID) {
+				continue
+			}
+			if (f.Job == nil || f.Job.MatchString(c.job)) && (f.Name == nil || f.Name.MatchString(s.people[c.personID].Name)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func anyNameMatches(re *regexp.Regexp, people []Person) bool {
+	for _, p := range people {
+		if re.MatchString(p.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) hasGenreMatching(movieID int, genre *regexp.Regexp) bool {
+	for _, g := range s.genres[movieID] {
+		if genre.MatchString(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) LinkActor(link CastLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[link.MovieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", link.MovieID)
+	}
+	if _, ok := s.people[link.ActorID]; !ok {
+		return fmt.Errorf("person %d does not exist", link.ActorID)
+	}
+	for i := range s.cast {
+		existing := &s.cast[i]
+		if existing.movieID == link.MovieID && existing.actorID == link.ActorID {
+			if link.Character != "" {
+				existing.character = link.Character
+			}
+			if link.Order != 0 {
+				existing.order = link.Order
+			}
+			return nil
+		}
+	}
+	s.cast = append(s.cast, castLink{movieID: link.MovieID, actorID: link.ActorID, character: link.Character, order: link.Order})
+	return nil
+}
+
+func (s *memoryStore) UnlinkActor(movieID, actorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, link := range s.cast {
+		if link.movieID == movieID && link.actorID == actorID {
+			s.cast = append(s.cast[:i], s.cast[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) AddCredit(movieID, personID int, job string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", movieID)
+	}
+	if _, ok := s.people[personID]; !ok {
+		return fmt.Errorf("person %d does not exist", personID)
+	}
+	c := credit{movieID: movieID, personID: personID, job: job}
+	for _, existing := range s.credits {
+		if existing == c {
+			return nil
+		}
+	}
+	s.credits = append(s.credits, c)
+	return nil
+}
+
+func (s *memoryStore) RemoveCredit(movieID, personID int, job string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := credit{movieID: movieID, personID: personID, job: job}
+	for i, existing := range s.credits {
+		if existing == c {
+			s.credits = append(s.credits[:i], s.credits[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) MovieCredits(movieID int) ([]Credit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var credits []Credit
+	for _, c := range s.credits {
+		if c.movieID == movieID && !s.trashedPerson(c.personID) {
+			credits = append(credits, Credit{MovieID: c.movieID, PersonID: c.personID, Name: s.people[c.personID].Name, Job: c.job})
+		}
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		if credits[i].Job != credits[j].Job {
+			return credits[i].Job < credits[j].Job
+		}
+		return credits[i].Name < credits[j].Name
+	})
+	return credits, nil
+}
+
+func (s *memoryStore) LinkGenre(movieID int, genre string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", movieID)
+	}
+	for _, g := range s.genres[movieID] {
+		if g == genre {
+			return nil
+		}
+	}
+	s.genres[movieID] = append(s.genres[movieID], genre)
+	sort.Strings(s.genres[movieID])
+	return nil
+}
+
+func (s *memoryStore) UnlinkGenre(movieID int, genre string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	genres := s.genres[movieID]
+	for i, g := range genres {
+		if g == genre {
+			s.genres[movieID] = append(genres[:i:i], genres[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) MovieGenres(movieID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.genres[movieID]...), nil
+}
+
+func (s *memoryStore) MovieCast(movieID int, actor *regexp.Regexp) ([]CastMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movie, ok := s.movies[movieID]
+	if !ok {
+		return nil, nil
+	}
+
+	var cast []CastMember
+	for _, link := range s.cast {
+		if link.movieID != movieID || s.trashedPerson(link.actorID) {
+			continue
+		}
+		p := s.people[link.actorID]
+		if actor != nil && !actor.MatchString(p.Name) {
+			continue
+		}
+		cast = append(cast, castMember(*p, *movie, link.character, link.order))
+	}
+	sort.Slice(cast, func(i, j int) bool {
+		a, b := cast[i], cast[j]
+		if (a.Order == 0) != (b.Order == 0) {
+			return b.Order == 0
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.Name < b.Name
+	})
+	return cast, nil
+}
+
+func (s *memoryStore) RateMovie(movieID int, rating Rating) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", movieID)
+	}
+	s.ratings[userMovie{s.user, movieID}] = rating
+	return nil
+}
+
+func (s *memoryStore) UnrateMovie(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userMovie{s.user, movieID}
+	if _, ok := s.ratings[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.ratings, key)
+	return nil
+}
+
+func (s *memoryStore) SetNote(movieID int, text string, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", movieID)
+	}
+	s.notes[userMovie{s.user, movieID}] = Note{MovieID: movieID, Text: text, UpdatedAt: updatedAt}
+	return nil
+}
+
+func (s *memoryStore) DeleteNote(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userMovie{s.user, movieID}
+	if _, ok := s.notes[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.notes, key)
+	return nil
+}
+
+func (s *memoryStore) MovieNote(movieID int) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[userMovie{s.user, movieID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	note := s.note(n)
+	return &note, nil
+}
+
+func (s *memoryStore) Notes() ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []Note
+	for key, n := range s.notes {
+		if key.user == s.user && !s.trashedMovie(key.movieID) {
+			notes = append(notes, s.note(n))
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Title != notes[j].Title {
+			return notes[i].Title < notes[j].Title
+		}
+		return notes[i].MovieID < notes[j].MovieID
+	})
+	return notes, nil
+}
+
+// note fills in the movie details of a stored note.
+func (s *memoryStore) note(n Note) Note {
+	m := s.movies[n.MovieID]
+	n.Title = m.Title
+	n.Director = s.directorName(m)
+	n.ReleaseYear = m.ReleaseYear
+	return n
+}
+
+func (s *memoryStore) watched(movieID int) bool {
+	for _, v := range s.viewings {
+		if v.user == s.user && v.movieID == movieID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) AddToWatchlist(movieID int, addedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return false, fmt.Errorf("movie %d does not exist", movieID)
+	}
+	key := userMovie{s.user, movieID}
+	if _, ok := s.watchlist[key]; ok {
+		return false, nil
+	}
+	s.watchlist[key] = addedAt
+	return true, nil
+}
+
+func (s *memoryStore) RemoveFromWatchlist(movieID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := userMovie{s.user, movieID}
+	if _, ok := s.watchlist[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.watchlist, key)
+	return nil
+}
+
+func (s *memoryStore) Watchlist() ([]WatchEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []WatchEntry
+	for key, addedAt := range s.watchlist {
+		if key.user == s.user && !s.trashedMovie(key.movieID) {
+			entries = append(entries, s.watchEntry(key.movieID, addedAt))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		return entries[i].Title < entries[j].Title
+	})
+	return entries, nil
+}
+
+func (s *memoryStore) LogViewing(movieID int, watchedOn time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return fmt.Errorf("movie %d does not exist", movieID)
+	}
+	s.viewings = append(s.viewings, viewing{user: s.user, movieID: movieID, watchedOn: watchedOn})
+	return nil
+}
+
+func (s *memoryStore) Viewings() ([]WatchEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []WatchEntry
+	// Newest first; later log entries win ties like the SQL id ordering
+	for i := len(s.viewings) - 1; i >= 0; i-- {
+		if v := s.viewings[i]; v.user == s.user && !s.trashedMovie(v.movieID) {
+			entries = append(entries, s.watchEntry(v.movieID, v.watchedOn))
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.After(entries[j].Date) })
+	return entries, nil
+}
+
+func (s *memoryStore) watchEntry(movieID int, date time.Time) WatchEntry {
+	m := s.movies[movieID]
+	return WatchEntry{
+		MovieID:     m.ID,
+		Title:       m.Title,
+		Director:    s.directorName(m),
+		ReleaseYear: m.ReleaseYear,
+		Date:        date,
+	}
+}
+
+func (s *memoryStore) People() ([]Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	people := make([]Person, 0, len(s.people))
+	for _, p := range s.people {
+		if p.TrashedAt.IsZero() {
+			people = append(people, *p)
+		}
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+	return people, nil
+}
+
+func (s *memoryStore) Movies() ([]Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movies := make([]Movie, 0, len(s.movies))
+	for _, m := range s.movies {
+		if m.TrashedAt.IsZero() {
+			movies = append(movies, *m)
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].ID < movies[j].ID })
+	return movies, nil
+}
+
+func (s *memoryStore) CastLinks() ([]CastLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := make([]CastLink, 0, len(s.cast))
+	for _, link := range s.cast {
+		if s.trashedMovie(link.movieID) || s.trashedPerson(link.actorID) {
+			continue
+		}
+		links = append(links, CastLink{MovieID: link.movieID, ActorID: link.actorID, Character: link.character, Order: link.order})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].MovieID != links[j].MovieID {
+			return links[i].MovieID < links[j].MovieID
+		}
+		return links[i].ActorID < links[j].ActorID
+	})
+	return links, nil
+}
+
+func (s *memoryStore) Credits() ([]Credit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credits := make([]Credit, 0, len(s.credits))
+	for _, c := range s.credits {
+		if s.trashedMovie(c.movieID) || s.trashedPerson(c.personID) {
+			continue
+		}
+		credits = append(credits, Credit{MovieID: c.movieID, PersonID: c.personID, Name: s.people[c.personID].Name, Job: c.job})
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+		if a.MovieID != b.MovieID {
+			return a.MovieID < b.MovieID
+		}
+		if a.PersonID != b.PersonID {
+			return a.PersonID < b.PersonID
+		}
+		return a.Job < b.Job
+	})
+	return credits, nil
+}
+
+func (s *memoryStore) RecordChange(entry JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.journal[:0]
+	for _, e := range s.journal {
+		if !e.Undone {
+			kept = append(kept, e)
+		}
+	}
+	entry.ID, entry.Undone = s.newID(), false
+	s.journal = append(kept, entry)
+	return nil
+}
+
+func (s *memoryStore) NextChange(undone bool) (*JournalEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Undone changes always follow the others
+	for i := range s.journal {
+		if e := s.journal[i]; undone && e.Undone {
+			return &e, nil
+		}
+		if e := s.journal[len(s.journal)-1-i]; !undone && !e.Undone {
+			return &e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) MarkChange(id int, undone bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.journal {
+		if s.journal[i].ID == id {
+			s.journal[i].Undone = undone
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) Changes() ([]JournalEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]JournalEntry(nil), s.journal...), nil
+}
+
+func (s *memoryStore) ForgetChange(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.journal {
+		if s.journal[i].ID == id {
+			s.journal = append(s.journal[:i:i], s.journal[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) RecordAudit(entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = s.newID()
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *memoryStore) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []AuditEntry
+	for _, e := range s.audit {
+		switch {
+		case filter.Entity != "" && e.Entity != filter.Entity,
+			filter.Name != nil && !filter.Name.MatchString(e.EntityName),
+			!filter.Since.IsZero() && e.RecordedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !e.RecordedAt.Before(filter.Until):
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
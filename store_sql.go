@@ -0,0 +1,1407 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqlStore implements MovieStore on top of database/sql. Postgres and SQLite
+// share the same queries; the dialect only decides the regex operator and
+// which migrations are applied.
+type sqlStore struct {
+	db      *sql.DB
+	q       querier // db, or the transaction opened by Atomically
+	inTx    bool
+	dialect string
+	// The current user profile, see SwitchUser
+	userID   int
+	userName string
+}
+
+// querier is the part of *sql.DB and *sql.Tx the queries use.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const sqliteDriverName = "sqlite3_movies"
+
+func init() {
+	// SQLite has a REGEXP operator but no implementation behind it, so
+	// provide one using Go's regexp package.
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", func(pattern, s string) (bool, error) {
+				return regexp.MatchString(pattern, s)
+			}, true)
+		},
+	})
+}
+
+func newPostgresStore(url string) (*sqlStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlStore{db: db, q: db, dialect: "postgres"}, nil
+}
+
+func newSQLiteStore(path string) (*sqlStore, error) {
+	db, err := sql.Open(sqliteDriverName, "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// A single connection keeps SQLite from reporting "database is locked"
+	// when a transaction and a plain query overlap.
+	db.SetMaxOpenConns(1)
+	return &sqlStore{db: db, q: db, dialect: "sqlite"}, nil
+}
+
+func (s *sqlStore) Close() error {
+	if s.inTx {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *sqlStore) Atomically(fn func(tx MovieStore) error) error {
+	return s.transact(func(tx *sqlStore) error {
+		return fn(tx)
+	})
+}
+
+// transact runs fn in a transaction. If s is already bound to a transaction
+// fn runs under a savepoint instead, so that its failure leaves the enclosing
+// transaction usable (Postgres aborts a transaction on any failed statement).
+func (s *sqlStore) transact(fn func(tx *sqlStore) error) error {
+	if s.inTx {
+		if _, err := s.q.Exec("SAVEPOINT nested"); err != nil {
+			return fmt.Errorf("failed to set savepoint: %w", err)
+		}
+		if err := fn(s); err != nil {
+			s.q.Exec("ROLLBACK TO SAVEPOINT nested")
+			s.q.Exec("RELEASE SAVEPOINT nested")
+			return err
+		}
+		_, err := s.q.Exec("RELEASE SAVEPOINT nested")
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	if err := fn(&sqlStore{db: s.db, q: tx, inTx: true, dialect: s.dialect, userID: s.userID, userName: s.userName}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// regexMatch returns a condition matching column against a regex parameter.
+func (s *sqlStore) regexMatch(column, param string) string {
+	if s.dialect == "sqlite" {
+		return column + " REGEXP " + param
+	}
+	return column + " ~ " + param
+}
+
+func (s *sqlStore) SwitchUser(name string) (bool, error) {
+	var userID int
+	created := true
+	err := s.q.QueryRow("INSERT INTO users (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id", name).Scan(&userID)
+	if err == sql.ErrNoRows {
+		created = false
+		err = s.q.QueryRow("SELECT id FROM users WHERE name = $1", name).Scan(&userID)
+	}
+	if err != nil {
+		return false, err
+	}
+	s.userID, s.userName = userID, name
+	return created, nil
+}
+
+func (s *sqlStore) CurrentUser() string {
+	return s.userName
+}
+
+func (s *sqlStore) Users() ([]string, error) {
+	rows, err := s.q.Query("SELECT name FROM users ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		users = append(users, name)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) PeopleByName(name string) ([]Person, error) {
+	return s.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE name = $1 AND trashed_at IS NULL ORDER BY birth_year IS NULL, birth_year, id", name)
+}
+
+func (s *sqlStore) PersonByID(id int) (*Person, error) {
+	people, err := s.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 {
+		return nil, ErrNotFound
+	}
+	return &people[0], nil
+}
+
+func (s *sqlStore) PersonByTMDbID(tmdbID int) (*Person, error) {
+	people, err := s.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE tmdb_id = $1", tmdbID)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 {
+		return nil, ErrNotFound
+	}
+	return &people[0], nil
+}
+
+func (s *sqlStore) Namesakes() ([]Person, error) {
+	return s.people(`
+		SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people
+		WHERE trashed_at IS NULL AND name IN (SELECT name FROM people WHERE trashed_at IS NULL GROUP BY name HAVING COUNT(*) > 1)
+		ORDER BY name, birth_year IS NULL, birth_year, id
+	`)
+}
+
+func (s *sqlStore) AddPerson(person Person) (int, bool, error) {
+	var personID int
+	created := false
+	err := s.transact(func(tx *sqlStore) error {
+		err := tx.q.QueryRow("SELECT id FROM people WHERE name = $1 AND COALESCE(birth_year, 0) = $2 AND trashed_at IS NULL", person.Name, person.BirthYear).Scan(&personID)
+		if err != sql.ErrNoRows {
+			return err
+		}
+		created = true
+		return tx.q.QueryRow(
+			"INSERT INTO people (name, birth_year, birth_date, death_date) VALUES ($1, $2, $3, $4) RETURNING id",
+			person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate),
+		).Scan(&personID)
+	})
+	return personID, created, err
+}
+
+func (s *sqlStore) UpsertPerson(person Person) (int, bool, error) {
+	var personID int
+	created := false
+	err := s.transact(func(tx *sqlStore) error {
+		candidates, err := tx.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE (name = $1 AND trashed_at IS NULL) OR tmdb_id = $2 ORDER BY id", person.Name, nullInt(person.TMDbID))
+		if err != nil {
+			return err
+		}
+
+		match := upsertMatch(candidates, person)
+		if match == nil {
+			created = true
+			return tx.q.QueryRow(
+				"INSERT INTO people (name, birth_year, birth_date, death_date, tmdb_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+				person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate), nullInt(person.TMDbID),
+			).Scan(&personID)
+		}
+
+		// Keep what the catalog knows unless TMDb says otherwise
+		personID = match.ID
+		_, err = tx.q.Exec(`
+			UPDATE people SET
+				name = $1,
+				birth_year = COALESCE($2, birth_year),
+				birth_date = COALESCE($3, birth_date),
+				death_date = COALESCE($4, death_date),
+				tmdb_id = COALESCE($5, tmdb_id),
+				trashed_at = NULL
+			WHERE id = $6
+		`, person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate), nullInt(person.TMDbID), personID)
+		return err
+	})
+	return personID, created, err
+}
+
+func (s *sqlStore) InsertPerson(person Person) (int, error) {
+	var personID int
+	err := s.transact(func(tx *sqlStore) error {
+		err := tx.q.QueryRow(
+			"INSERT INTO people (name, birth_year, birth_date, death_date, tmdb_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate), nullInt(person.TMDbID),
+		).Scan(&personID)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("person with TMDb ID %d %w", person.TMDbID, ErrAlreadyExists)
+		}
+		return err
+	})
+	return personID, err
+}
+
+func (s *sqlStore) UpdatePerson(person Person) error {
+	result, err := s.q.Exec(
+		"UPDATE people SET name = $1, birth_year = $2, birth_date = $3, death_date = $4 WHERE id = $5",
+		person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate), person.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) PutPerson(person Person) error {
+	_, err := s.q.Exec(`
+		INSERT INTO people (id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, birth_year = EXCLUDED.birth_year,
+			birth_date = EXCLUDED.birth_date, death_date = EXCLUDED.death_date, tmdb_id = EXCLUDED.tmdb_id, trashed_at = EXCLUDED.trashed_at
+	`, person.ID, person.Name, nullInt(person.BirthYear), nullDate(person.BirthDate), nullDate(person.DeathDate), nullInt(person.TMDbID), nullTime(person.TrashedAt))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("person '%s' %w", person.Name, ErrAlreadyExists)
+	}
+	return err
+}
+
+func (s *sqlStore) DeletePerson(id int) error {
+	return s.transact(func(tx *sqlStore) error {
+		_, err := tx.q.Exec("DELETE FROM movie_actors WHERE actor_id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete references from movie_actors: %w", err)
+		}
+
+		_, err = tx.q.Exec("DELETE FROM credits WHERE person_id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete references from credits: %w", err)
+		}
+
+		_, err = tx.q.Exec("DELETE FROM people WHERE id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete person: %w", err)
+		}
+		return nil
+	})
+}
+
+// setTrashed moves a row of the table to the trash, or with at zero takes it
+// out again. It returns ErrNotFound if the row is missing or already there.
+func (s *sqlStore) setTrashed(table string, id int, at time.Time) error {
+	query := "UPDATE " + table + " SET trashed_at = $1 WHERE id = $2 AND trashed_at IS NULL"
+	if at.IsZero() {
+		query = "UPDATE " + table + " SET trashed_at = $1 WHERE id = $2 AND trashed_at IS NOT NULL"
+	}
+	result, err := s.q.Exec(query, nullTime(at), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) TrashPerson(id int, at time.Time) error {
+	return s.setTrashed("people", id, at)
+}
+
+func (s *sqlStore) RestorePerson(id int) error {
+	return s.setTrashed("people", id, time.Time{})
+}
+
+func (s *sqlStore) TrashedPeople() ([]Person, error) {
+	return s.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE trashed_at IS NOT NULL ORDER BY trashed_at DESC, id")
+}
+
+func (s *sqlStore) CountMoviesDirected(personID int) (int, error) {
+	var count int
+	err := s.q.QueryRow(`
+		SELECT COUNT(DISTINCT c.movie_id) FROM credits c
+		JOIN movies m ON c.movie_id = m.id
+		WHERE c.person_id = $1 AND c.job = 'Director' AND m.trashed_at IS NULL
+	`, personID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) MoviesActedIn(personID int) ([]Movie, error) {
+	rows, err := s.q.Query(`
+		SELECT m.id, m.title, m.director_id, m.release_year, m.release_date, m.length_minutes, m.tmdb_id, m.trashed_at
+		FROM movies m
+		JOIN movie_actors ma ON m.id = ma.movie_id
+		WHERE ma.actor_id = $1 AND m.trashed_at IS NULL
+		ORDER BY m.release_year, m.title
+	`, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []Movie
+	for rows.Next() {
+		m, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+	return movies, rows.Err()
+}
+
+func (s *sqlStore) PersonMovieIDs(personID int) ([]int, error) {
+	rows, err := s.q.Query(`
+		SELECT id FROM movies
+		WHERE trashed_at IS NULL AND (
+			director_id = $1
+			OR id IN (SELECT movie_id FROM movie_actors WHERE actor_id = $1)
+			OR id IN (SELECT movie_id FROM credits WHERE person_id = $1)
+		)
+		ORDER BY id
+	`, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStore) AddMovie(movie Movie) (int, error) {
+	var movieID int
+	err := s.transact(func(tx *sqlStore) error {
+		err := tx.q.QueryRow(
+			"INSERT INTO movies (title, director_id, release_year, release_date, length_minutes, tmdb_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			movie.Title, nullInt(movie.DirectorID), movie.ReleaseYear, nullDate(movie.ReleaseDate), movie.LengthMinutes, nullInt(movie.TMDbID),
+		).Scan(&movieID)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+		} else if err != nil {
+			return err
+		}
+		if movie.DirectorID == 0 {
+			return nil
+		}
+		return tx.AddCredit(movieID, movie.DirectorID, "Director")
+	})
+	if err != nil {
+		return 0, err
+	}
+	return movieID, nil
+}
+
+func (s *sqlStore) PutMovie(movie Movie) error {
+	_, err := s.q.Exec(`
+		INSERT INTO movies (id, title, director_id, release_year, release_date, length_minutes, tmdb_id, trashed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, director_id = EXCLUDED.director_id, release_year = EXCLUDED.release_year,
+			release_date = EXCLUDED.release_date, length_minutes = EXCLUDED.length_minutes, tmdb_id = EXCLUDED.tmdb_id, trashed_at = EXCLUDED.trashed_at
+	`, movie.ID, movie.Title, nullInt(movie.DirectorID), movie.ReleaseYear, nullDate(movie.ReleaseDate), movie.LengthMinutes, nullInt(movie.TMDbID), nullTime(movie.TrashedAt))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+	}
+	return err
+}
+
+func (s *sqlStore) UpdateMovie(movie Movie) error {
+	return s.transact(func(tx *sqlStore) error {
+		var directorID sql.NullInt64
+		err := tx.q.QueryRow("SELECT director_id FROM movies WHERE id = $1", movie.ID).Scan(&directorID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		_, err = tx.q.Exec(
+			"UPDATE movies SET title = $1, director_id = $2, release_year = $3, release_date = $4, length_minutes = $5 WHERE id = $6",
+			movie.Title, nullInt(movie.DirectorID), movie.ReleaseYear, nullDate(movie.ReleaseDate), movie.LengthMinutes, movie.ID,
+		)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("movie %q %w", movie.Title, ErrAlreadyExists)
+		} else if err != nil {
+			return err
+		}
+		if int(directorID.Int64) == movie.DirectorID {
+			return nil
+		}
+
+		if directorID.Valid {
+			_, err = tx.q.Exec("DELETE FROM credits WHERE movie_id = $1 AND person_id = $2 AND job = 'Director'", movie.ID, directorID.Int64)
+			if err != nil {
+				return err
+			}
+		}
+		if movie.DirectorID == 0 {
+			return nil
+		}
+		return tx.AddCredit(movie.ID, movie.DirectorID, "Director")
+	})
+}
+
+func (s *sqlStore) ReassignDirector(fromID, toID int) error {
+	return s.transact(func(tx *sqlStore) error {
+		_, err := tx.q.Exec(`
+			UPDATE movies SET director_id = COALESCE($1, (
+				SELECT MIN(c.person_id) FROM credits c
+				WHERE c.movie_id = movies.id AND c.job = 'Director' AND c.person_id <> $2
+			))
+			WHERE director_id = $2 AND trashed_at IS NULL
+		`, nullInt(toID), fromID)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("a movie by the new director %w", ErrAlreadyExists)
+		} else if err != nil {
+			return err
+		}
+
+		if toID != 0 {
+			_, err = tx.q.Exec(`
+				INSERT INTO credits (movie_id, person_id, job)
+				SELECT movie_id, $1, job FROM credits
+				WHERE person_id = $2 AND job = 'Director' AND movie_id IN (SELECT id FROM movies WHERE trashed_at IS NULL)
+				ON CONFLICT DO NOTHING
+			`, toID, fromID)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.q.Exec(`
+			DELETE FROM credits
+			WHERE person_id = $1 AND job = 'Director' AND movie_id IN (SELECT id FROM movies WHERE trashed_at IS NULL)
+		`, fromID)
+		return err
+	})
+}
+
+func (s *sqlStore) DeleteMovie(id int) error {
+	return s.transact(func(tx *sqlStore) error {
+		for _, table := range []string{"movie_actors", "movie_genres", "credits", "ratings", "notes", "watchlist", "viewings"} {
+			if _, err := tx.q.Exec("DELETE FROM "+table+" WHERE movie_id = $1", id); err != nil {
+				return fmt.Errorf("failed to delete references from %s: %w", table, err)
+			}
+		}
+
+		result, err := tx.q.Exec("DELETE FROM movies WHERE id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete movie: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) TrashMovie(id int, at time.Time) error {
+	return s.setTrashed("movies", id, at)
+}
+
+func (s *sqlStore) RestoreMovie(id int) error {
+	return s.setTrashed("movies", id, time.Time{})
+}
+
+func (s *sqlStore) TrashedMovies() ([]Movie, error) {
+	return s.movies("SELECT id, title, director_id, release_year, release_date, length_minutes, tmdb_id, trashed_at FROM movies WHERE trashed_at IS NOT NULL ORDER BY trashed_at DESC, id")
+}
+
+func (s *sqlStore) MovieByID(id int) (*MovieListing, error) {
+	return s.movieWhere("m.id = $2", id)
+}
+
+func (s *sqlStore) MovieByTMDbID(tmdbID int) (*MovieListing, error) {
+	return s.movieWhere("m.tmdb_id = $2", tmdbID)
+}
+
+// movieWhere returns the movie matching a condition on its $2 parameter.
+func (s *sqlStore) movieWhere(condition string, arg interface{}) (*MovieListing, error) {
+	m, err := scanListing(s.q.QueryRow(`
+		SELECT m.id, m.title, m.director_id, p.name, m.release_year, m.release_date, m.length_minutes, m.tmdb_id, m.trashed_at, r.score, r.review, r.rated_at
+		FROM movies m
+		LEFT JOIN people p ON m.director_id = p.id
+		LEFT JOIN ratings r ON r.movie_id = m.id AND r.user_id = $1
+		WHERE `+condition, s.userID, arg))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if m.Genres, err = s.MovieGenres(m.ID); err != nil {
+		return nil, err
+	}
+	movies := []MovieListing{m}
+	if err := s.attachDirectors(movies); err != nil {
+		return nil, err
+	}
+	return &movies[0], nil
+}
+
+func (s *sqlStore) CountMovies() (int, error) {
+	var count int
+	err := s.q.QueryRow("SELECT COUNT(*) FROM movies WHERE trashed_at IS NULL").Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) ListMovies(filter MovieFilter) ([]MovieListing, error) {
+	query := `
+		SELECT
+			m.id,
+			m.title,
+			m.director_id,
+			p.name AS director,
+			m.release_year,
+			m.release_date,
+			m.length_minutes,
+			m.tmdb_id,
+			m.trashed_at,
+			r.score,
+			r.review,
+			r.rated_at
+		FROM
+			movies m
+		LEFT JOIN
+			people p ON m.director_id = p.id
+		LEFT JOIN
+			ratings r ON r.movie_id = m.id AND r.user_id = $1
+	`
+
+	// Append filters; $1 is the current user
+	filters := []string{"m.trashed_at IS NULL"}
+	params := []interface{}{s.userID}
+	paramIndex := 2
+
+	if filter.Title != nil {
+		filters = append(filters, s.regexMatch("m.title", fmt.Sprintf("$%d", paramIndex)))
+		params = append(params, filter.Title.String())
+		paramIndex++
+	}
+	if filter.Director != nil {
+		// Any of the directors will do, not only the one in movies
+		filters = append(filters, "EXISTS (SELECT 1 FROM credits cd JOIN people pd ON cd.person_id = pd.id WHERE cd.movie_id = m.id AND cd.job = 'Director' AND pd.trashed_at IS NULL AND "+
+			s.regexMatch("pd.name", fmt.Sprintf("$%d", paramIndex))+")")
+		params = append(params, filter.Director.String())
+		paramIndex++
+	}
+	if filter.Actor != nil {
+		// Join the movie_actors table to filter by actor
+		filters = append(filters, "EXISTS (SELECT 1 FROM movie_actors ma JOIN people pa ON ma.actor_id = pa.id WHERE ma.movie_id = m.id AND pa.trashed_at IS NULL AND "+
+			s.regexMatch("pa.name", fmt.Sprintf("$%d", paramIndex))+")")
+		params = append(params, filter.Actor.String())
+		paramIndex++
+	}
+	if filter.Genre != nil {
+		filters = append(filters, "EXISTS (SELECT 1 FROM movie_genres mg JOIN genres g ON mg.genre_id = g.id WHERE mg.movie_id = m.id AND "+
+			s.regexMatch("g.name", fmt.Sprintf("$%d", paramIndex))+")")
+		params = append(params, filter.Genre.String())
+		paramIndex++
+	}
+	for _, crew := range filter.Crew {
+		condition := "EXISTS (SELECT 1 FROM credits c JOIN people pc ON c.person_id = pc.id WHERE c.movie_id = m.id AND pc.trashed_at IS NULL"
+		if crew.Job != nil {
+			condition += " AND " + s.regexMatch("c.job", fmt.Sprintf("$%d", paramIndex))
+			params = append(params, crew.Job.String())
+			paramIndex++
+		}
+		if crew.Name != nil {
+			condition += " AND " + s.regexMatch("pc.name", fmt.Sprintf("$%d", paramIndex))
+			params = append(params, crew.Name.String())
+			paramIndex++
+		}
+		filters = append(filters, condition+")")
+	}
+	if filter.Watched != nil {
+		condition := "EXISTS (SELECT 1 FROM viewings v WHERE v.movie_id = m.id AND v.user_id = $1)"
+		if !*filter.Watched {
+			condition = "NOT " + condition
+		}
+		filters = append(filters, condition)
+	}
+	if filter.MinRating > 0 {
+		filters = append(filters, fmt.Sprintf("r.score >= $%d", paramIndex))
+		params = append(params, filter.MinRating)
+		paramIndex++
+	}
+
+	query += " WHERE " + strings.Join(filters, " AND ")
+
+	// Add ORDER BY clause
+	switch filter.OrderBy {
+	case "length_asc":
+		query += " ORDER BY m.length_minutes ASC, m.title"
+	case "length_desc":
+		query += " ORDER BY m.length_minutes DESC, m.title"
+	case "rating_asc":
+		query += " ORDER BY r.score IS NULL, r.score ASC, m.title"
+	case "rating_desc":
+		query += " ORDER BY r.score IS NULL, r.score DESC, m.title"
+	default:
+		query += " ORDER BY m.title"
+	}
+
+	rows, err := s.q.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []MovieListing
+	for rows.Next() {
+		m, err := scanListing(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := s.attachGenres(movies); err != nil {
+		return nil, err
+	}
+	if err := s.attachDirectors(movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// attachGenres fills in the genres of the listed movies.
+func (s *sqlStore) attachGenres(movies []MovieListing) error {
+	byID := map[int]*MovieListing{}
+	ids := make([]int, 0, len(movies))
+	for i := range movies {
+		byID[movies[i].ID] = &movies[i]
+		ids = append(ids, movies[i].ID)
+	}
+
+	return s.queryByIDs(`
+		SELECT mg.movie_id, g.name
+		FROM movie_genres mg
+		JOIN genres g ON mg.genre_id = g.id
+		WHERE mg.movie_id IN %s
+		ORDER BY g.name
+	`, ids, func(rows *sql.Rows) error {
+		var movieID int
+		var genre string
+		if err := rows.Scan(&movieID, &genre); err != nil {
+			return err
+		}
+		byID[movieID].Genres = append(byID[movieID].Genres, genre)
+		return nil
+	})
+}
+
+// queryByIDs runs query, whose %s is replaced by an idList, for batches of
+// at most maxQueryIDs of ids and calls scan for every row.
+func (s *sqlStore) queryByIDs(query string, ids []int, scan func(rows *sql.Rows) error) error {
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), maxQueryIDs)]
+		ids = ids[len(batch):]
+
+		in, args := idList(batch)
+		rows, err := s.q.Query(fmt.Sprintf(query, in), args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxQueryIDs bounds the parameters of an idList, well below the limits of
+// both Postgres and SQLite.
+const maxQueryIDs = 500
+
+// idList returns a parenthesized list of placeholders for ids, for use with
+// IN, and the matching query arguments.
+func idList(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// attachDirectors fills in every director of the listed movies, the one in
+// movies first.
+func (s *sqlStore) attachDirectors(movies []MovieListing) error {
+	byID := map[int]*MovieListing{}
+	ids := make([]int, 0, len(movies))
+	for i := range movies {
+		byID[movies[i].ID] = &movies[i]
+		ids = append(ids, movies[i].ID)
+	}
+
+	return s.queryByIDs(`
+		SELECT c.movie_id, p.id, p.name, p.birth_year, p.birth_date, p.death_date, p.tmdb_id
+		FROM credits c
+		JOIN people p ON c.person_id = p.id
+		JOIN movies m ON c.movie_id = m.id
+		WHERE c.job = 'Director' AND p.trashed_at IS NULL AND c.movie_id IN %s
+		ORDER BY c.person_id <> m.director_id, p.name
+	`, ids, func(rows *sql.Rows) error {
+		var movieID int
+		var director Person
+		var birthYear, tmdbID sql.NullInt64
+		var birthDate, deathDate sql.NullTime
+		if err := rows.Scan(&movieID, &director.ID, &director.Name, &birthYear, &birthDate, &deathDate, &tmdbID); err != nil {
+			return err
+		}
+		director.BirthYear, director.TMDbID = int(birthYear.Int64), int(tmdbID.Int64)
+		director.BirthDate, director.DeathDate = birthDate.Time, deathDate.Time
+		byID[movieID].Directors = append(byID[movieID].Directors, director)
+		return nil
+	})
+}
+
+func (s *sqlStore) AddCredit(movieID, personID int, job string) error {
+	_, err := s.q.Exec("INSERT INTO credits (movie_id, person_id, job) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", movieID, personID, job)
+	return err
+}
+
+func (s *sqlStore) RemoveCredit(movieID, personID int, job string) error {
+	result, err := s.q.Exec("DELETE FROM credits WHERE movie_id = $1 AND person_id = $2 AND job = $3", movieID, personID, job)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) MovieCredits(movieID int) ([]Credit, error) {
+	return s.credits(`
+		SELECT c.movie_id, c.person_id, p.name, c.job
+		FROM credits c
+		JOIN people p ON c.person_id = p.id
+		WHERE c.movie_id = $1 AND p.trashed_at IS NULL
+		ORDER BY c.job, p.name
+	`, movieID)
+}
+
+func (s *sqlStore) Credits() ([]Credit, error) {
+	return s.credits(`
+		SELECT c.movie_id, c.person_id, p.name, c.job
+		FROM credits c
+		JOIN people p ON c.person_id = p.id
+		JOIN movies m ON c.movie_id = m.id
+		WHERE p.trashed_at IS NULL AND m.trashed_at IS NULL
+		ORDER BY c.movie_id, c.person_id, c.job
+	`)
+}
+
+func (s *sqlStore) credits(query string, args ...interface{}) ([]Credit, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credits []Credit
+	for rows.Next() {
+		var c Credit
+		if err := rows.Scan(&c.MovieID, &c.PersonID, &c.Name, &c.Job); err != nil {
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+	return credits, rows.Err()
+}
+
+func (s *sqlStore) LinkActor(link CastLink) error {
+	_, err := s.q.Exec(`
+		INSERT INTO movie_actors (movie_id, actor_id, character_name, billing_order) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (movie_id, actor_id) DO UPDATE SET
+			character_name = COALESCE(EXCLUDED.character_name, movie_actors.character_name),
+			billing_order = COALESCE(EXCLUDED.billing_order, movie_actors.billing_order)
+	`, link.MovieID, link.ActorID, nullString(link.Character), nullInt(link.Order))
+	return err
+}
+
+func (s *sqlStore) UnlinkActor(movieID, actorID int) error {
+	result, err := s.q.Exec("DELETE FROM movie_actors WHERE movie_id = $1 AND actor_id = $2", movieID, actorID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) LinkGenre(movieID int, genre string) error {
+	return s.transact(func(tx *sqlStore) error {
+		var genreID int
+		err := tx.q.QueryRow("INSERT INTO genres (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name RETURNING id", genre).Scan(&genreID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.Exec("INSERT INTO movie_genres (movie_id, genre_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", movieID, genreID)
+		return err
+	})
+}
+
+func (s *sqlStore) UnlinkGenre(movieID int, genre string) error {
+	result, err := s.q.Exec("DELETE FROM movie_genres WHERE movie_id = $1 AND genre_id = (SELECT id FROM genres WHERE name = $2)", movieID, genre)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) MovieGenres(movieID int) ([]string, error) {
+	rows, err := s.q.Query("SELECT g.name FROM movie_genres mg JOIN genres g ON mg.genre_id = g.id WHERE mg.movie_id = $1 ORDER BY g.name", movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []string
+	for rows.Next() {
+		var genre string
+		if err := rows.Scan(&genre); err != nil {
+			return nil, err
+		}
+		genres = append(genres, genre)
+	}
+	return genres, rows.Err()
+}
+
+func (s *sqlStore) MovieCast(movieID int, actor *regexp.Regexp) ([]CastMember, error) {
+	query := `
+		SELECT
+			p.id,
+			p.name,
+			p.birth_year,
+			p.birth_date,
+			p.death_date,
+			m.release_year,
+			m.release_date,
+			ma.character_name,
+			ma.billing_order
+		FROM
+			people p
+		JOIN
+			movie_actors ma ON p.id = ma.actor_id
+		JOIN
+			movies m ON ma.movie_id = m.id
+		WHERE
+			m.id = $1 AND p.trashed_at IS NULL
+	`
+	params := []interface{}{movieID}
+
+	// Checking if an actor regex is provided
+	if actor != nil {
+		query += " AND " + s.regexMatch("p.name", "$2")
+		params = append(params, actor.String())
+	}
+	query += " ORDER BY ma.billing_order IS NULL, ma.billing_order, p.name"
+
+	rows, err := s.q.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cast []CastMember
+	for rows.Next() {
+		var p Person
+		var m Movie
+		var birthYear, order sql.NullInt64
+		var birthDate, deathDate, releaseDate sql.NullTime
+		var character sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &birthYear, &birthDate, &deathDate, &m.ReleaseYear, &releaseDate, &character, &order); err != nil {
+			return nil, err
+		}
+		p.BirthYear, p.BirthDate, p.DeathDate = int(birthYear.Int64), birthDate.Time, deathDate.Time
+		m.ReleaseDate = releaseDate.Time
+		cast = append(cast, castMember(p, m, character.String, int(order.Int64)))
+	}
+	return cast, rows.Err()
+}
+
+func (s *sqlStore) RateMovie(movieID int, rating Rating) error {
+	_, err := s.q.Exec(`
+		INSERT INTO ratings (user_id, movie_id, score, review, rated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, movie_id) DO UPDATE SET score=EXCLUDED.score, review=EXCLUDED.review, rated_at=EXCLUDED.rated_at
+	`, s.userID, movieID, rating.Score, nullString(rating.Review), rating.RatedAt.UTC())
+	return err
+}
+
+func (s *sqlStore) UnrateMovie(movieID int) error {
+	result, err := s.q.Exec("DELETE FROM ratings WHERE user_id = $1 AND movie_id = $2", s.userID, movieID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) SetNote(movieID int, text string, updatedAt time.Time) error {
+	_, err := s.q.Exec(`
+		INSERT INTO notes (user_id, movie_id, body, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, movie_id) DO UPDATE SET body=EXCLUDED.body, updated_at=EXCLUDED.updated_at
+	`, s.userID, movieID, text, updatedAt.UTC())
+	return err
+}
+
+func (s *sqlStore) DeleteNote(movieID int) error {
+	result, err := s.q.Exec("DELETE FROM notes WHERE user_id = $1 AND movie_id = $2", s.userID, movieID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) MovieNote(movieID int) (*Note, error) {
+	notes, err := s.notes("WHERE n.user_id = $1 AND n.movie_id = $2", s.userID, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, ErrNotFound
+	}
+	return &notes[0], nil
+}
+
+func (s *sqlStore) Notes() ([]Note, error) {
+	return s.notes("WHERE n.user_id = $1 AND m.trashed_at IS NULL", s.userID)
+}
+
+// notes runs a query for notes restricted by where.
+func (s *sqlStore) notes(where string, args ...interface{}) ([]Note, error) {
+	rows, err := s.q.Query(`
+		SELECT m.id, m.title, p.name, m.release_year, n.body, n.updated_at
+		FROM notes n
+		JOIN movies m ON n.movie_id = m.id
+		LEFT JOIN people p ON m.director_id = p.id
+		`+where+`
+		ORDER BY m.title, m.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		var year sql.NullInt64
+		var director sql.NullString
+		if err := rows.Scan(&n.MovieID, &n.Title, &director, &year, &n.Text, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+		n.Director, n.ReleaseYear = director.String, int(year.Int64)
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+func (s *sqlStore) AddToWatchlist(movieID int, addedAt time.Time) (bool, error) {
+	result, err := s.q.Exec("INSERT INTO watchlist (user_id, movie_id, added_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", s.userID, movieID, addedAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlStore) RemoveFromWatchlist(movieID int) error {
+	result, err := s.q.Exec("DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2", s.userID, movieID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) Watchlist() ([]WatchEntry, error) {
+	return s.watchEntries(`
+		SELECT m.id, m.title, p.name, m.release_year, w.added_at
+		FROM watchlist w
+		JOIN movies m ON w.movie_id = m.id
+		LEFT JOIN people p ON m.director_id = p.id
+		WHERE w.user_id = $1 AND m.trashed_at IS NULL
+		ORDER BY w.added_at, m.title
+	`, s.userID)
+}
+
+func (s *sqlStore) LogViewing(movieID int, watchedOn time.Time) error {
+	_, err := s.q.Exec("INSERT INTO viewings (user_id, movie_id, watched_on) VALUES ($1, $2, $3)", s.userID, movieID, watchedOn)
+	return err
+}
+
+func (s *sqlStore) Viewings() ([]WatchEntry, error) {
+	return s.watchEntries(`
+		SELECT m.id, m.title, p.name, m.release_year, v.watched_on
+		FROM viewings v
+		JOIN movies m ON v.movie_id = m.id
+		LEFT JOIN people p ON m.director_id = p.id
+		WHERE v.user_id = $1 AND m.trashed_at IS NULL
+		ORDER BY v.watched_on DESC, v.id DESC
+	`, s.userID)
+}
+
+func (s *sqlStore) watchEntries(query string, args ...interface{}) ([]WatchEntry, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WatchEntry
+	for rows.Next() {
+		var e WatchEntry
+		var year sql.NullInt64
+		var director sql.NullString
+		if err := rows.Scan(&e.MovieID, &e.Title, &director, &year, &e.Date); err != nil {
+			return nil, err
+		}
+		e.Director = director.String
+		e.ReleaseYear = int(year.Int64)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) People() ([]Person, error) {
+	return s.people("SELECT id, name, birth_year, birth_date, death_date, tmdb_id, trashed_at FROM people WHERE trashed_at IS NULL ORDER BY id")
+}
+
+func (s *sqlStore) people(query string, args ...interface{}) ([]Person, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var people []Person
+	for rows.Next() {
+		var p Person
+		var birthYear, tmdbID sql.NullInt64
+		var birthDate, deathDate, trashedAt sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Name, &birthYear, &birthDate, &deathDate, &tmdbID, &trashedAt); err != nil {
+			return nil, err
+		}
+		p.BirthYear = int(birthYear.Int64)
+		p.BirthDate, p.DeathDate, p.TrashedAt = birthDate.Time, deathDate.Time, trashedAt.Time
+		p.TMDbID = int(tmdbID.Int64)
+		people = append(people, p)
+	}
+	return people, rows.Err()
+}
+
+func (s *sqlStore) Movies() ([]Movie, error) {
+	return s.movies("SELECT id, title, director_id, release_year, release_date, length_minutes, tmdb_id, trashed_at FROM movies WHERE trashed_at IS NULL ORDER BY id")
+}
+
+func (s *sqlStore) movies(query string, args ...interface{}) ([]Movie, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []Movie
+	for rows.Next() {
+		m, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+	return movies, rows.Err()
+}
+
+func (s *sqlStore) CastLinks() ([]CastLink, error) {
+	rows, err := s.q.Query(`
+		SELECT ma.movie_id, ma.actor_id, ma.character_name, ma.billing_order
+		FROM movie_actors ma
+		JOIN movies m ON ma.movie_id = m.id
+		JOIN people p ON ma.actor_id = p.id
+		WHERE m.trashed_at IS NULL AND p.trashed_at IS NULL
+		ORDER BY ma.movie_id, ma.actor_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []CastLink
+	for rows.Next() {
+		var link CastLink
+		var character sql.NullString
+		var order sql.NullInt64
+		if err := rows.Scan(&link.MovieID, &link.ActorID, &character, &order); err != nil {
+			return nil, err
+		}
+		link.Character = character.String
+		link.Order = int(order.Int64)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (s *sqlStore) RecordChange(entry JournalEntry) error {
+	return s.transact(func(tx *sqlStore) error {
+		if _, err := tx.q.Exec("DELETE FROM journal WHERE undone"); err != nil {
+			return err
+		}
+		_, err := tx.q.Exec(
+			"INSERT INTO journal (summary, before_state, after_state, recorded_at) VALUES ($1, $2, $3, $4)",
+			entry.Summary, entry.Before, entry.After, entry.RecordedAt,
+		)
+		return err
+	})
+}
+
+func (s *sqlStore) NextChange(undone bool) (*JournalEntry, error) {
+	query := "SELECT id, summary, before_state, after_state, undone, recorded_at FROM journal WHERE NOT undone ORDER BY id DESC LIMIT 1"
+	if undone {
+		query = "SELECT id, summary, before_state, after_state, undone, recorded_at FROM journal WHERE undone ORDER BY id LIMIT 1"
+	}
+	var e JournalEntry
+	err := s.q.QueryRow(query).Scan(&e.ID, &e.Summary, &e.Before, &e.After, &e.Undone, &e.RecordedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *sqlStore) MarkChange(id int, undone bool) error {
+	result, err := s.q.Exec("UPDATE journal SET undone = $1 WHERE id = $2", undone, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) Changes() ([]JournalEntry, error) {
+	rows, err := s.q.Query("SELECT id, summary, before_state, after_state, undone, recorded_at FROM journal ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []JournalEntry
+	for rows.Next() {
+		var e JournalEntry
+		if err := rows.Scan(&e.ID, &e.Summary, &e.Before, &e.After, &e.Undone, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) ForgetChange(id int) error {
+	result, err := s.q.Exec("DELETE FROM journal WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) RecordAudit(entry AuditEntry) error {
+	_, err := s.q.Exec(`
+		INSERT INTO audit_log (user_name, operation, entity, entity_id, entity_name, summary, before_state, after_state, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, entry.User, entry.Operation, entry.Entity, entry.EntityID, entry.EntityName, entry.Summary,
+		sql.NullString{String: entry.Before, Valid: entry.Before != ""},
+		sql.NullString{String: entry.After, Valid: entry.After != ""},
+		entry.RecordedAt)
+	return err
+}
+
+func (s *sqlStore) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	query := "SELECT id, user_name, operation, entity, entity_id, entity_name, summary, before_state, after_state, recorded_at FROM audit_log"
+
+	var filters []string
+	var params []interface{}
+	if filter.Entity != "" {
+		params = append(params, filter.Entity)
+		filters = append(filters, fmt.Sprintf("entity = $%d", len(params)))
+	}
+	if filter.Name != nil {
+		params = append(params, filter.Name.String())
+		filters = append(filters, s.regexMatch("entity_name", fmt.Sprintf("$%d", len(params))))
+	}
+	if !filter.Since.IsZero() {
+		params = append(params, filter.Since.UTC())
+		filters = append(filters, fmt.Sprintf("recorded_at >= $%d", len(params)))
+	}
+	if !filter.Until.IsZero() {
+		params = append(params, filter.Until.UTC())
+		filters = append(filters, fmt.Sprintf("recorded_at < $%d", len(params)))
+	}
+	if len(filters) > 0 {
+		query += " WHERE " + strings.Join(filters, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.q.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.User, &e.Operation, &e.Entity, &e.EntityID, &e.EntityName, &e.Summary, &before, &after, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before.String, after.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// scanListing reads the columns selected by ListMovies and MovieByID.
+func scanListing(row interface{ Scan(...interface{}) error }) (MovieListing, error) {
+	var m MovieListing
+	var directorID, tmdbID, score sql.NullInt64
+	var director, review sql.NullString
+	var ratedAt, releaseDate, trashedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.Title, &directorID, &director, &m.ReleaseYear, &releaseDate, &m.LengthMinutes, &tmdbID, &trashedAt, &score, &review, &ratedAt)
+	m.DirectorID, m.Director = int(directorID.Int64), director.String
+	m.TMDbID = int(tmdbID.Int64)
+	m.ReleaseDate, m.TrashedAt = releaseDate.Time, trashedAt.Time
+	if score.Valid {
+		m.Rating = &Rating{Score: int(score.Int64), Review: review.String, RatedAt: ratedAt.Time}
+	}
+	return m, err
+}
+
+func scanMovie(row interface{ Scan(...interface{}) error }) (Movie, error) {
+	var m Movie
+	var directorID, year, length, tmdbID sql.NullInt64
+	var releaseDate, trashedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.Title, &directorID, &year, &releaseDate, &length, &tmdbID, &trashedAt)
+	m.ReleaseDate, m.TrashedAt = releaseDate.Time, trashedAt.Time
+	m.DirectorID = int(directorID.Int64)
+	m.ReleaseYear = int(year.Int64)
+	m.LengthMinutes = int(length.Int64)
+	m.TMDbID = int(tmdbID.Int64)
+	return m, err
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure from
+// either driver.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// nullInt maps the zero value to SQL NULL.
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+// nullDate maps the zero time to SQL NULL and anything else to its date.
+func nullDate(v time.Time) sql.NullTime {
+	if v.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC), Valid: true}
+}
+
+// nullTime maps the zero time to SQL NULL and stores others in UTC.
+func nullTime(v time.Time) sql.NullTime {
+	if v.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: v.UTC(), Valid: true}
+}
+
+// nullString maps the empty string to SQL NULL.
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
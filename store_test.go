@@ -0,0 +1,565 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores runs test against every backend that works without a server: the
+// memory store and a migrated SQLite file.
+func testStores(t *testing.T, test func(t *testing.T, store MovieStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestSQLiteStore(t))
+	})
+}
+
+// newTestSQLiteStore opens a migrated SQLite catalog in a temporary
+// directory.
+func newTestSQLiteStore(t *testing.T) *sqlStore {
+	t.Helper()
+	store, err := newSQLiteStore(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := migrateUp(store.db, store.dialect, 0, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func mustAddPerson(t *testing.T, store MovieStore, name string, birthYear int) int {
+	t.Helper()
+	id, _, err := store.AddPerson(Person{Name: name, BirthYear: birthYear})
+	if err != nil {
+		t.Fatalf("AddPerson(%s): %v", name, err)
+	}
+	return id
+}
+
+// personByName returns the first person with that name, or ErrNotFound.
+func personByName(store MovieStore, name string) (*Person, error) {
+	people, err := store.PeopleByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(people) == 0 {
+		return nil, ErrNotFound
+	}
+	return &people[0], nil
+}
+
+func TestStorePeople(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		id, created, err := store.AddPerson(Person{Name: "Harrison Ford", BirthYear: 1942})
+		if err != nil || !created {
+			t.Fatalf("AddPerson = %d, %v, %v; want a new person", id, created, err)
+		}
+		if _, created, err := store.AddPerson(Person{Name: "Harrison Ford", BirthYear: 1942}); err != nil || created {
+			t.Errorf("adding the same person again = %v, %v; want false, nil", created, err)
+		}
+
+		// TMDb fills in what the catalog is missing
+		upserted, created, err := store.UpsertPerson(Person{Name: "Harrison Ford", TMDbID: 3})
+		if err != nil || created || upserted != id {
+			t.Errorf("UpsertPerson of an existing person = %d, %v, %v; want %d", upserted, created, err, id)
+		}
+		if person, err := store.PersonByID(id); err != nil || person.BirthYear != 1942 || person.TMDbID != 3 {
+			t.Errorf("person after UpsertPerson = %+v, %v; want born 1942 with TMDb ID 3", person, err)
+		}
+
+		// A different birth year makes a namesake
+		namesake, created, err := store.AddPerson(Person{Name: "Harrison Ford", BirthYear: 1882})
+		if err != nil || !created {
+			t.Fatalf("AddPerson of a namesake = %d, %v, %v; want a new person", namesake, created, err)
+		}
+		if people, err := store.PeopleByName("Harrison Ford"); err != nil || len(people) != 2 || people[0].ID != namesake {
+			t.Errorf("PeopleByName = %+v, %v; want both namesakes, the older first", people, err)
+		}
+		if people, err := store.Namesakes(); err != nil || len(people) != 2 {
+			t.Errorf("Namesakes = %+v, %v; want both namesakes", people, err)
+		}
+		if _, err := store.InsertPerson(Person{Name: "Harrison Ford", BirthYear: 1942}); err != nil {
+			t.Errorf("InsertPerson of a namesake: %v", err)
+		}
+		if _, err := store.InsertPerson(Person{Name: "Someone Else", TMDbID: 3}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("InsertPerson with a taken TMDb ID: err = %v; want ErrAlreadyExists", err)
+		}
+
+		if err := store.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.PersonByID(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("PersonByID after DeletePerson: err = %v; want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreMovies(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		actor := mustAddPerson(t, store, "Sigourney Weaver", 1949)
+
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1980}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("AddMovie with a title the director already has: err = %v; want ErrAlreadyExists", err)
+		}
+		if err := store.LinkActor(CastLink{MovieID: movieID, ActorID: actor, Character: "Ripley", Order: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LinkActor(CastLink{MovieID: movieID, ActorID: actor}); err != nil {
+			t.Errorf("linking an actor twice: %v", err)
+		}
+
+		for _, genre := range []string{"Sci-Fi", "Horror", "Horror"} {
+			if err := store.LinkGenre(movieID, genre); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		movies, err := store.ListMovies(MovieFilter{OrderBy: "title"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movies) != 1 || movies[0].Title != "Alien" || movies[0].Director != "Ridley Scott" || movies[0].LengthMinutes != 117 {
+			t.Errorf("ListMovies = %+v", movies)
+		}
+		if len(movies) == 1 && strings.Join(movies[0].Genres, ",") != "Horror,Sci-Fi" {
+			t.Errorf("genres = %v; want Horror and Sci-Fi", movies[0].Genres)
+		}
+		if movies, err := store.ListMovies(MovieFilter{Genre: regexp.MustCompile("^Western$")}); err != nil || len(movies) != 0 {
+			t.Errorf("ListMovies of Westerns = %+v, %v; want none", movies, err)
+		}
+
+		codirector := mustAddPerson(t, store, "Tony Scott", 1944)
+		if err := store.AddCredit(movieID, codirector, "Director"); err != nil {
+			t.Fatal(err)
+		}
+		if movies, err := store.ListMovies(MovieFilter{}); err != nil || len(movies) != 1 || (len(movies[0].Directors) != 2 || movies[0].Directors[0].Name != "Ridley Scott" || movies[0].Directors[1].Name != "Tony Scott") {
+			t.Errorf("ListMovies with a co-director = %+v, %v; want both directors, main one first", movies, err)
+		}
+		cast, err := store.MovieCast(movieID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cast) != 1 || cast[0].PersonID != actor || cast[0].Age != 30 || cast[0].Character != "Ripley" || cast[0].Order != 1 {
+			t.Errorf("MovieCast = %+v; want Sigourney Weaver as Ripley, billed first, aged 30", cast)
+		}
+		if n, err := store.CountMoviesDirected(director); err != nil || n != 1 {
+			t.Errorf("CountMoviesDirected = %d, %v; want 1", n, err)
+		}
+		if acted, err := store.MoviesActedIn(actor); err != nil || len(acted) != 1 || acted[0].ID != movieID {
+			t.Errorf("MoviesActedIn = %+v, %v", acted, err)
+		}
+
+		if err := store.DeletePerson(actor); err != nil {
+			t.Fatal(err)
+		}
+		if cast, err := store.MovieCast(movieID, nil); err != nil || len(cast) != 0 {
+			t.Errorf("MovieCast after deleting the actor = %+v, %v; want nobody", cast, err)
+		}
+	})
+}
+
+func TestStoreRemakes(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Alfred Hitchcock", 1899)
+
+		// TMDb tells a director's movies with one title apart
+		if _, err := store.AddMovie(Movie{Title: "The Man Who Knew Too Much", DirectorID: director, ReleaseYear: 1934, TMDbID: 7017}); err != nil {
+			t.Fatal(err)
+		}
+		remake, err := store.AddMovie(Movie{Title: "The Man Who Knew Too Much", DirectorID: director, ReleaseYear: 1956, TMDbID: 574})
+		if err != nil {
+			t.Fatalf("AddMovie of a remake with its own TMDb ID: %v", err)
+		}
+		if movie, err := store.MovieByTMDbID(574); err != nil || movie.ID != remake || movie.ReleaseYear != 1956 {
+			t.Errorf("MovieByTMDbID(574) = %+v, %v; want the remake", movie, err)
+		}
+		if _, err := store.AddMovie(Movie{Title: "Rope", DirectorID: director, TMDbID: 7017}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("AddMovie with a taken TMDb ID: err = %v; want ErrAlreadyExists", err)
+		}
+
+		// Without a TMDb ID only the title and director tell them apart
+		if _, err := store.AddMovie(Movie{Title: "The Man Who Knew Too Much", DirectorID: director}); err != nil {
+			t.Errorf("AddMovie without a TMDb ID: %v", err)
+		}
+		if _, err := store.AddMovie(Movie{Title: "The Man Who Knew Too Much", DirectorID: director}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("AddMovie of a title the director has without a TMDb ID: err = %v; want ErrAlreadyExists", err)
+		}
+		if movies, err := store.ListMovies(MovieFilter{}); err != nil || len(movies) != 3 {
+			t.Errorf("ListMovies = %+v, %v; want all three movies", movies, err)
+		}
+	})
+}
+
+func TestStoreUpdates(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		other := mustAddPerson(t, store, "Tony Scott", 1944)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddMovie(Movie{Title: "Top Gun", DirectorID: other, ReleaseYear: 1986}); err != nil {
+			t.Fatal(err)
+		}
+
+		died := time.Date(2012, 8, 19, 0, 0, 0, 0, time.UTC)
+		if err := store.UpdatePerson(Person{ID: other, Name: "Tony Scott", BirthYear: 1944, DeathDate: died}); err != nil {
+			t.Fatal(err)
+		}
+		if person, err := store.PersonByID(other); err != nil || !person.DeathDate.Equal(died) {
+			t.Errorf("person after UpdatePerson = %+v, %v; want died %s", person, err, died)
+		}
+		if err := store.UpdatePerson(Person{ID: 999, Name: "Nobody"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdatePerson of an unknown person: err = %v; want ErrNotFound", err)
+		}
+
+		// The Director credit moves along with the director
+		edited := Movie{ID: movieID, Title: "Alien", DirectorID: other, ReleaseYear: 1979, LengthMinutes: 116}
+		if err := store.UpdateMovie(edited); err != nil {
+			t.Fatal(err)
+		}
+		if movie, err := store.MovieByID(movieID); err != nil || movie.Director != "Tony Scott" || len(movie.Directors) != 1 || movie.LengthMinutes != 116 {
+			t.Errorf("movie after UpdateMovie = %+v, %v; want directed by Tony Scott only", movie, err)
+		}
+		edited.Title = "Top Gun"
+		if err := store.UpdateMovie(edited); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("UpdateMovie to a title the director has: err = %v; want ErrAlreadyExists", err)
+		}
+	})
+}
+
+func TestStoreDeleteMovie(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		actor := mustAddPerson(t, store, "Sigourney Weaver", 1949)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		when := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		for _, err := range []error{
+			store.LinkActor(CastLink{MovieID: movieID, ActorID: actor}),
+			store.LinkGenre(movieID, "Horror"),
+			store.RateMovie(movieID, Rating{Score: 9, RatedAt: when}),
+			store.SetNote(movieID, "Watch the director's cut", when),
+			store.LogViewing(movieID, when),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := store.AddToWatchlist(movieID, when); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeleteMovie(movieID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.MovieByID(movieID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("MovieByID after DeleteMovie: err = %v; want ErrNotFound", err)
+		}
+		if notes, err := store.Notes(); err != nil || len(notes) != 0 {
+			t.Errorf("Notes after DeleteMovie = %+v, %v; want none", notes, err)
+		}
+		if entries, err := store.Watchlist(); err != nil || len(entries) != 0 {
+			t.Errorf("Watchlist after DeleteMovie = %+v, %v; want none", entries, err)
+		}
+		if entries, err := store.Viewings(); err != nil || len(entries) != 0 {
+			t.Errorf("Viewings after DeleteMovie = %+v, %v; want none", entries, err)
+		}
+		if acted, err := store.MoviesActedIn(actor); err != nil || len(acted) != 0 {
+			t.Errorf("MoviesActedIn after DeleteMovie = %+v, %v; want none", acted, err)
+		}
+		if err := store.DeleteMovie(movieID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting a deleted movie: err = %v; want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreNotes(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		noted := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetNote(movieID, "Watch the director's cut", noted); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetNote(movieID, "Watch the theatrical cut", noted); err != nil {
+			t.Fatal(err)
+		}
+		note, err := store.MovieNote(movieID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if note.Text != "Watch the theatrical cut" || note.Title != "Alien" || note.Director != "Ridley Scott" || !note.UpdatedAt.Equal(noted) {
+			t.Errorf("MovieNote = %+v", note)
+		}
+
+		// Notes belong to the user who wrote them
+		if _, err := store.SwitchUser("bob"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.MovieNote(movieID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("MovieNote of another user: err = %v; want ErrNotFound", err)
+		}
+		if err := store.SetNote(movieID, "Too scary", noted); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		if notes, err := store.Notes(); err != nil || len(notes) != 1 || notes[0].Text != "Watch the theatrical cut" {
+			t.Errorf("Notes = %+v, %v; want only alice's note", notes, err)
+		}
+
+		if err := store.DeleteNote(movieID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteNote(movieID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting a deleted note: err = %v; want ErrNotFound", err)
+		}
+		if _, err := store.SwitchUser("bob"); err != nil {
+			t.Fatal(err)
+		}
+		if note, err := store.MovieNote(movieID); err != nil || note.Text != "Too scary" {
+			t.Errorf("bob's note after alice deleted hers = %+v, %v", note, err)
+		}
+
+		// A movie that lost its director keeps its notes
+		if err := store.ReassignDirector(director, 0); err != nil {
+			t.Fatal(err)
+		}
+		if notes, err := store.Notes(); err != nil || len(notes) != 1 || notes[0].Director != "" {
+			t.Errorf("Notes of a movie without a director = %+v, %v; want bob's note", notes, err)
+		}
+	})
+}
+
+func TestStoreTrash(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		director := mustAddPerson(t, store, "Ridley Scott", 1937)
+		codirector := mustAddPerson(t, store, "Tony Scott", 1944)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddCredit(movieID, codirector, "Director"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetNote(movieID, "Watch the director's cut", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		trashed := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+
+		// A trashed director, the movie's own included, is left out of
+		// its directors by every backend
+		if err := store.TrashPerson(director, trashed); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.TrashPerson(director, trashed); !errors.Is(err, ErrNotFound) {
+			t.Errorf("trashing a trashed person: err = %v; want ErrNotFound", err)
+		}
+		if movie, err := store.MovieByID(movieID); err != nil || len(movie.Directors) != 1 || movie.Directors[0].ID != codirector {
+			t.Errorf("MovieByID with the director trashed = %+v, %v; want only Tony Scott as director", movie, err)
+		}
+		if movies, err := store.ListMovies(MovieFilter{}); err != nil || len(movies) != 1 || len(movies[0].Directors) != 1 || movies[0].Directors[0].ID != codirector {
+			t.Errorf("ListMovies with the director trashed = %+v, %v; want only Tony Scott as director", movies, err)
+		}
+		if people, err := store.TrashedPeople(); err != nil || len(people) != 1 || people[0].ID != director || !people[0].TrashedAt.Equal(trashed) {
+			t.Errorf("TrashedPeople = %+v, %v; want Ridley Scott", people, err)
+		}
+		if err := store.RestorePerson(director); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RestorePerson(director); !errors.Is(err, ErrNotFound) {
+			t.Errorf("restoring a person outside the trash: err = %v; want ErrNotFound", err)
+		}
+		if movie, err := store.MovieByID(movieID); err != nil || len(movie.Directors) != 2 || movie.Directors[0].ID != director {
+			t.Errorf("MovieByID with the director restored = %+v, %v; want both directors, main one first", movie, err)
+		}
+
+		// A trashed movie is hidden but still found by ID, and its title
+		// stays taken
+		if err := store.TrashMovie(movieID, trashed); err != nil {
+			t.Fatal(err)
+		}
+		if movies, err := store.ListMovies(MovieFilter{}); err != nil || len(movies) != 0 {
+			t.Errorf("ListMovies with the movie trashed = %+v, %v; want none", movies, err)
+		}
+		if notes, err := store.Notes(); err != nil || len(notes) != 0 {
+			t.Errorf("Notes with the movie trashed = %+v, %v; want none", notes, err)
+		}
+		if movie, err := store.MovieByID(movieID); err != nil || !movie.TrashedAt.Equal(trashed) {
+			t.Errorf("MovieByID of a trashed movie = %+v, %v", movie, err)
+		}
+		if _, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979}); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("AddMovie with the title of a trashed movie: err = %v; want ErrAlreadyExists", err)
+		}
+		if err := store.RestoreMovie(movieID); err != nil {
+			t.Fatal(err)
+		}
+		if notes, err := store.Notes(); err != nil || len(notes) != 1 {
+			t.Errorf("Notes with the movie restored = %+v, %v; want the note back", notes, err)
+		}
+	})
+}
+
+func TestStoreAtomicallyRollsBack(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		errFail := errors.New("fail")
+		err := store.Atomically(func(tx MovieStore) error {
+			mustAddPerson(t, tx, "Rolled Back", 0)
+			return errFail
+		})
+		if !errors.Is(err, errFail) {
+			t.Fatalf("Atomically: err = %v; want fn's error", err)
+		}
+		if _, err := personByName(store, "Rolled Back"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("PersonByName after a rollback: err = %v; want ErrNotFound", err)
+		}
+
+		// A failed nested call only undoes its own changes
+		err = store.Atomically(func(tx MovieStore) error {
+			mustAddPerson(t, tx, "Kept", 0)
+			if err := tx.Atomically(func(tx MovieStore) error {
+				mustAddPerson(t, tx, "Nested", 0)
+				return errFail
+			}); !errors.Is(err, errFail) {
+				t.Errorf("nested Atomically: err = %v; want fn's error", err)
+			}
+			mustAddPerson(t, tx, "Also Kept", 0)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Atomically after a failed nested call: %v", err)
+		}
+		for name, want := range map[string]error{"Kept": nil, "Also Kept": nil, "Nested": ErrNotFound} {
+			if _, err := personByName(store, name); !errors.Is(err, want) {
+				t.Errorf("PersonByName(%s): err = %v; want %v", name, err, want)
+			}
+		}
+	})
+}
+
+func TestMemoryStoreAtomicallyKeepsConcurrentWrites(t *testing.T) {
+	store := newMemoryStore()
+	var wg sync.WaitGroup
+	err := store.Atomically(func(tx MovieStore) error {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := store.AddPerson(Person{Name: "Concurrent"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("fail")
+	})
+	if err == nil {
+		t.Fatal("Atomically succeeded; want fn's error")
+	}
+	wg.Wait()
+
+	if _, err := personByName(store, "Concurrent"); err != nil {
+		t.Errorf("a write made during a failed Atomically was lost: %v", err)
+	}
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	migrations, err := loadMigrations(store.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := migrateDown(store.db, store.dialect, 0, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(migrations) {
+		t.Errorf("migrateDown reverted %d migrations; want %d", n, len(migrations))
+	}
+	var tables int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('people', 'movies')").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("%d catalog tables left after reverting every migration", tables)
+	}
+
+	if n, err = migrateUp(store.db, store.dialect, 0, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(migrations) {
+		t.Errorf("migrateUp applied %d migrations; want %d", n, len(migrations))
+	}
+	if n, err = migrateUp(store.db, store.dialect, 0, io.Discard); err != nil || n != 0 {
+		t.Errorf("migrateUp with nothing pending = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestDropSchema(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	mustAddPerson(t, store, "John Smith", 0)
+	mustAddPerson(t, store, "John Smith", 1950)
+	if _, err := store.db.Exec("CREATE TABLE bookmarks (url TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Namesakes keep 0008_tmdb_ids from being reverted, not from a reset
+	if err := dropSchema(store.db, store.dialect, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	rows, err := store.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	if strings.Join(tables, ",") != "bookmarks" {
+		t.Errorf("tables after dropSchema = %v; want only bookmarks", tables)
+	}
+
+	migrations, err := loadMigrations(store.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := migrateUp(store.db, store.dialect, 0, io.Discard); err != nil || n != len(migrations) {
+		t.Errorf("migrateUp after dropSchema = %d, %v; want %d, nil", n, err, len(migrations))
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const trashUsage = `usage: trash
+       restore -p <name> | -m <title> [year]
+       purge -p <name> | -m <title> [year] | -all`
+
+// trashCommand implements `trash`, which lists what was deleted, and
+// `restore` and `purge`, which bring it back or remove it for good. args[0]
+// is the command. Purging asks for confirmation unless in is nil.
+func trashCommand(store MovieStore, in *console, args []string) error {
+	switch args[0] {
+	case "trash", "list":
+		if len(args) != 1 {
+			return usageError{trashUsage}
+		}
+		return printTrash(store)
+	case "restore", "purge":
+	default:
+		return usageError{trashUsage}
+	}
+
+	fs := newCommandFlagSet(args[0])
+	person := fs.Bool("p", false, "a person in the trash")
+	movie := fs.Bool("m", false, "a movie in the trash")
+	all := false
+	if args[0] == "purge" {
+		fs.BoolVar(&all, "all", false, "everything in the trash")
+	}
+	rest, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	switch {
+	case all && (*person || *movie || len(rest) > 0):
+		return usageError{trashUsage}
+	case all:
+		return purgeAll(store, in)
+	case *person == *movie:
+		return usageError{trashUsage}
+	case *person && len(rest) != 1, *movie && (len(rest) == 0 || len(rest) > 2):
+		return usageError{trashUsage}
+	}
+
+	if *person {
+		p, err := findTrashedPerson(store, rest[0])
+		if err != nil {
+			return err
+		}
+		if args[0] == "restore" {
+			return restorePerson(store, p)
+		}
+		return purgePerson(store, in, p)
+	}
+
+	year := 0
+	if len(rest) == 2 {
+		if year, err = parseImportYear(rest[1]); err != nil {
+			return usageError{fmt.Sprintf("invalid release year: %v", err)}
+		}
+	}
+	m, err := findTrashedMovie(store, rest[0], year)
+	if err != nil {
+		return err
+	}
+	if args[0] == "restore" {
+		return restoreMovie(store, m)
+	}
+	return purgeRecords(store, in, fmt.Sprintf("purge movie '%s' (%d)", m.Title, m.ReleaseYear), nil, []Movie{*m})
+}
+
+// printTrash lists the people and movies in the trash, latest first.
+func printTrash(store MovieStore) error {
+	people, err := store.TrashedPeople()
+	if err != nil {
+		return fmt.Errorf("fetching people in the trash: %w", err)
+	}
+	movies, err := store.TrashedMovies()
+	if err != nil {
+		return fmt.Errorf("fetching movies in the trash: %w", err)
+	}
+	if len(people) == 0 && len(movies) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+
+	if len(people) > 0 {
+		labels := labelPeople(people)
+		fmt.Println("People:")
+		for _, p := range people {
+			fmt.Printf("    - %s, trashed %s\n", labels[p.ID], formatTrashedAt(p.TrashedAt))
+		}
+	}
+	if len(movies) > 0 {
+		fmt.Println("Movies:")
+		for _, m := range movies {
+			director, err := directorName(store, m)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("    - %s (%d) %s, trashed %s\n", m.Title, m.ReleaseYear, byDirector(director), formatTrashedAt(m.TrashedAt))
+		}
+	}
+	return nil
+}
+
+func formatTrashedAt(at time.Time) string {
+	return at.Local().Format("2006-01-02 15:04")
+}
+
+// directorName returns the name of the movie's director, in the trash or
+// not, or "" if it has none.
+func directorName(store MovieStore, m Movie) (string, error) {
+	if m.DirectorID == 0 {
+		return "", nil
+	}
+	director, err := store.PersonByID(m.DirectorID)
+	if err != nil {
+		return "", fmt.Errorf("fetching director of '%s': %w", m.Title, err)
+	}
+	return director.Name, nil
+}
+
+// findTrashedPerson is lookupPerson for the people in the trash.
+func findTrashedPerson(store MovieStore, label string) (*Person, error) {
+	trashed, err := store.TrashedPeople()
+	if err != nil {
+		return nil, fmt.Errorf("fetching people in the trash: %w", err)
+	}
+	person, err := matchPerson(label, func(name string) ([]Person, error) {
+		var people []Person
+		for _, p := range trashed {
+			if p.Name == name {
+				people = append(people, p)
+			}
+		}
+		return people, nil
+	})
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("person '%s' in the trash %w", label, ErrNotFound)
+	}
+	return person, err
+}
+
+// findTrashedMovie is findMovieReleased for the movies in the trash.
+func findTrashedMovie(store MovieStore, title string, year int) (*Movie, error) {
+	trashed, err := store.TrashedMovies()
+	if err != nil {
+		return nil, fmt.Errorf("fetching movies in the trash: %w", err)
+	}
+	var matches []Movie
+	for _, m := range trashed {
+		if m.Title == title && (year == 0 || m.ReleaseYear == year) {
+			matches = append(matches, m)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("movie '%s' in the trash %w", title, ErrNotFound)
+	case 1:
+		return &matches[0], nil
+	default:
+		var years []string
+		for _, m := range matches {
+			years = append(years, fmt.Sprint(m.ReleaseYear))
+		}
+		return nil, fmt.Errorf("movie title '%s' in the trash %w (%s); add the year", title, ErrAmbiguousTitle, joinNames(years))
+	}
+}
+
+// restorePerson takes the person out of the trash, back into the casts and
+// crews they were in, as a journaled change.
+func restorePerson(store MovieStore, person *Person) error {
+	err := journaled(store, fmt.Sprintf("restore person '%s'", person.Name), func(tx MovieStore, c *journalChange) error {
+		movieIDs, err := tx.PersonMovieIDs(person.ID)
+		if err != nil {
+			return fmt.Errorf("fetching movies of person %d: %w", person.ID, err)
+		}
+		if err := c.touchPeople(person.ID); err != nil {
+			return err
+		}
+		if err := c.touchMovies(movieIDs...); err != nil {
+			return err
+		}
+		return tx.RestorePerson(person.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("restoring person '%s': %w", person.Name, err)
+	}
+	fmt.Printf("Restored '%s' from the trash.\n", person.Name)
+	return nil
+}
+
+// restoreMovie takes the movie out of the trash as a journaled change. Its
+// director comes back with it if they are in the trash too, and so does
+// everyone trashed along with it.
+func restoreMovie(store MovieStore, movie *Movie) error {
+	var names []string
+	summary := fmt.Sprintf("restore movie '%s' (%d)", movie.Title, movie.ReleaseYear)
+	err := journaled(store, summary, func(tx MovieStore, c *journalChange) error {
+		if err := c.touchMovies(movie.ID); err != nil {
+			return err
+		}
+		trashed, err := tx.TrashedPeople()
+		if err != nil {
+			return fmt.Errorf("fetching people in the trash: %w", err)
+		}
+		for _, p := range trashed {
+			if p.ID != movie.DirectorID && !p.TrashedAt.Equal(movie.TrashedAt) {
+				continue
+			}
+			if err := c.touchPeople(p.ID); err != nil {
+				return err
+			}
+			if err := tx.RestorePerson(p.ID); err != nil {
+				return fmt.Errorf("restoring person '%s': %w", p.Name, err)
+			}
+			names = append(names, p.Name)
+		}
+		return tx.RestoreMovie(movie.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("restoring movie '%s': %w", movie.Title, err)
+	}
+	fmt.Printf("Restored '%s' (%d) from the trash.\n", movie.Title, movie.ReleaseYear)
+	if len(names) > 0 {
+		fmt.Printf("Also restored the people trashed with it: %s.\n", joinNames(names))
+	}
+	return nil
+}
+
+// purgePerson removes the person for good, along with the movies in the
+// trash they direct.
+func purgePerson(store MovieStore, in *console, person *Person) error {
+	directed, err := store.CountMoviesDirected(person.ID)
+	if err != nil {
+		return fmt.Errorf("checking director status for '%s': %w", person.Name, err)
+	}
+	if directed > 0 {
+		return fmt.Errorf("cannot purge '%s': %w", person.Name, ErrPersonIsDirector)
+	}
+	trashed, err := store.TrashedMovies()
+	if err != nil {
+		return fmt.Errorf("fetching movies in the trash: %w", err)
+	}
+	var movies []Movie
+	for _, m := range trashed {
+		if m.DirectorID == person.ID {
+			movies = append(movies, m)
+		}
+	}
+	return purgeRecords(store, in, fmt.Sprintf("purge person '%s'", person.Name), []Person{*person}, movies)
+}
+
+// purgeAll empties the trash.
+func purgeAll(store MovieStore, in *console) error {
+	people, err := store.TrashedPeople()
+	if err != nil {
+		return fmt.Errorf("fetching people in the trash: %w", err)
+	}
+	movies, err := store.TrashedMovies()
+	if err != nil {
+		return fmt.Errorf("fetching movies in the trash: %w", err)
+	}
+	if len(people) == 0 && len(movies) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+	return purgeRecords(store, in, "empty the trash", people, movies)
+}
+
+// purgeRecords previews the people and movies, and once confirmed deletes
+// them for good in one transaction. Purging is audited but not journaled:
+// there is nothing left to undo it with. Earlier journal entries involving
+// them are dropped too, so undo and redo cannot bring them back.
+func purgeRecords(store MovieStore, in *console, summary string, people []Person, movies []Movie) error {
+	fmt.Println("To be deleted for good:")
+	for _, p := range people {
+		fmt.Printf("    - %s\n", labelPeople([]Person{p})[p.ID])
+	}
+	for _, m := range movies {
+		fmt.Printf("    - %s (%d)\n", m.Title, m.ReleaseYear)
+	}
+	if in != nil {
+		confirmed, err := confirm(in, "Delete them for good?")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("Nothing was purged.")
+			return nil
+		}
+	}
+
+	var peopleIDs, movieIDs []int
+	for _, p := range people {
+		peopleIDs = append(peopleIDs, p.ID)
+	}
+	for _, m := range movies {
+		movieIDs = append(movieIDs, m.ID)
+	}
+	var forgotten int
+	err := store.Atomically(func(tx MovieStore) error {
+		before, err := snapshotState(tx, peopleIDs, movieIDs)
+		if err != nil {
+			return err
+		}
+		if forgotten, err = forgetRecords(tx, peopleIDs, movieIDs); err != nil {
+			return fmt.Errorf("updating the journal: %w", err)
+		}
+		// Movies first, as people cannot go while they still direct one
+		for _, m := range movies {
+			if err := tx.DeleteMovie(m.ID); err != nil {
+				return fmt.Errorf("purging movie '%s': %w", m.Title, err)
+			}
+		}
+		for _, p := range people {
+			if err := tx.DeletePerson(p.ID); err != nil {
+				return fmt.Errorf("purging person '%s': %w", p.Name, err)
+			}
+		}
+		after, err := snapshotState(tx, peopleIDs, movieIDs)
+		if err != nil {
+			return err
+		}
+		return auditChange(tx, summary, before, after)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d person(s) and %d movie(s).\n", len(people), len(movies))
+	if forgotten > 0 {
+		fmt.Printf("%d earlier change(s) involving them can no longer be undone or redone.\n", forgotten)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUndoAfterPurgeKeepsPersonGone(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		id := mustAddPerson(t, store, "Gone For Good", 1960)
+		person, err := store.PersonByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan, err := planDirectorDeletion(store, person, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := deleteDirector(store, plan); err != nil {
+			t.Fatal(err)
+		}
+		trashed, err := store.PersonByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := purgeRecords(store, nil, "purge person", []Person{*trashed}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := undoChange(store, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.PersonByID(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("PersonByID after undoing past a purge: err = %v; want ErrNotFound", err)
+		}
+	})
+}
+
+func TestRestoreArchiveFromTrash(t *testing.T) {
+	testStores(t, func(t *testing.T, store MovieStore) {
+		if _, err := store.SwitchUser("alice"); err != nil {
+			t.Fatal(err)
+		}
+		director, _, err := store.AddPerson(Person{Name: "Ridley Scott", BirthYear: 1937, TMDbID: 578})
+		if err != nil {
+			t.Fatal(err)
+		}
+		actor := mustAddPerson(t, store, "Sigourney Weaver", 1949)
+		movieID, err := store.AddMovie(Movie{Title: "Alien", DirectorID: director, ReleaseYear: 1979, LengthMinutes: 117})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.LinkActor(CastLink{MovieID: movieID, ActorID: actor, Character: "Ripley", Order: 1}); err != nil {
+			t.Fatal(err)
+		}
+		want := catalogContents(t, store)
+		archive, err := exportCatalog(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trashed := time.Now()
+		if err := store.TrashMovie(movieID, trashed); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []int{director, actor} {
+			if err := store.TrashPerson(id, trashed); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The trashed records match the archived ones and come back, rather
+		// than clash with them
+		if err := restoreCatalog(store, archive); err != nil {
+			t.Fatal(err)
+		}
+		if got := catalogContents(t, store); !reflect.DeepEqual(got, want) {
+			t.Errorf("catalog after restoring the trashed records:\n%q\nwant:\n%q", got, want)
+		}
+		if people, err := store.TrashedPeople(); err != nil || len(people) != 0 {
+			t.Errorf("TrashedPeople after the restore = %+v, %v; want none", people, err)
+		}
+		if movies, err := store.TrashedMovies(); err != nil || len(movies) != 0 {
+			t.Errorf("TrashedMovies after the restore = %+v, %v; want none", movies, err)
+		}
+
+		// Undoing the restore puts them back in the trash
+		if err := undoChange(store, false); err != nil {
+			t.Fatal(err)
+		}
+		if movies, err := store.TrashedMovies(); err != nil || len(movies) != 1 || movies[0].ID != movieID {
+			t.Errorf("TrashedMovies after undoing the restore = %+v, %v; want Alien", movies, err)
+		}
+	})
+}
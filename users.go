@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const userUsage = `usage: user [list | switch <name>]`
+
+// userCommand implements the `user` command: without arguments it shows the
+// current profile, `user list` lists them all and `user switch` changes the
+// profile for the rest of the session, creating it if needed.
+func userCommand(store MovieStore, args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("Current user: %s\n", store.CurrentUser())
+		return nil
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		if len(args) != 1 {
+			return usageError{userUsage}
+		}
+		users, err := store.Users()
+		if err != nil {
+			return fmt.Errorf("fetching users: %w", err)
+		}
+		current := store.CurrentUser()
+		for _, name := range users {
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+
+	case "switch":
+		if len(args) != 2 || strings.TrimSpace(args[1]) == "" {
+			return usageError{userUsage}
+		}
+		name := strings.TrimSpace(args[1])
+		created, err := store.SwitchUser(name)
+		if err != nil {
+			return fmt.Errorf("switching user: %w", err)
+		}
+		if created {
+			fmt.Printf("Created user %s and switched to it.\n", name)
+		} else {
+			fmt.Printf("Switched to user %s.\n", name)
+		}
+		return nil
+
+	default:
+		return usageError{userUsage}
+	}
+}
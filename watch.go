@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const watchUsage = `usage: w add|rm [-d director] <title>
+       w log [-d director] <title> [YYYY-MM-DD]
+       w list
+       w history`
+
+// watchCommand implements the `w` command, which keeps the watchlist and the
+// watch history.
+func watchCommand(store MovieStore, args []string) error {
+	if len(args) == 0 {
+		return usageError{watchUsage}
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		if len(args) != 1 {
+			return usageError{watchUsage}
+		}
+		return printWatchlist(store)
+
+	case "history":
+		if len(args) != 1 {
+			return usageError{watchUsage}
+		}
+		return printWatchHistory(store)
+
+	case "add", "rm", "log":
+	default:
+		return usageError{watchUsage}
+	}
+
+	fs := newCommandFlagSet("w " + args[0])
+	director := fs.String("d", "", "director of the movie")
+	rest, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 || len(rest) > 2 || (len(rest) == 2 && args[0] != "log") {
+		return usageError{watchUsage}
+	}
+	movie, err := findMovie(store, rest[0], *director)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		added, err := store.AddToWatchlist(movie.ID, time.Now())
+		if err != nil {
+			return fmt.Errorf("adding to watchlist: %w", err)
+		}
+		if !added {
+			return fmt.Errorf("'%s' is already on the watchlist", movie.Title)
+		}
+		fmt.Printf("Added %s to the watchlist.\n", movie.Title)
+
+	case "rm":
+		err := store.RemoveFromWatchlist(movie.ID)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("'%s' is not on the watchlist", movie.Title)
+		} else if err != nil {
+			return fmt.Errorf("removing from watchlist: %w", err)
+		}
+		fmt.Printf("Removed %s from the watchlist.\n", movie.Title)
+
+	case "log":
+		watchedOn := today()
+		if len(rest) == 2 {
+			if watchedOn, err = time.Parse("2006-01-02", rest[1]); err != nil {
+				return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", rest[1])
+			}
+		}
+		if err := store.LogViewing(movie.ID, watchedOn); err != nil {
+			return fmt.Errorf("logging viewing: %w", err)
+		}
+		fmt.Printf("Logged a viewing of %s on %s.\n", movie.Title, watchedOn.Format("2006-01-02"))
+
+		// Watching a movie takes it off the watchlist
+		if err := store.RemoveFromWatchlist(movie.ID); err == nil {
+			fmt.Printf("Removed %s from the watchlist.\n", movie.Title)
+		} else if !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("removing from watchlist: %w", err)
+		}
+	}
+	return nil
+}
+
+func printWatchlist(store MovieStore) error {
+	entries, err := store.Watchlist()
+	if err != nil {
+		return fmt.Errorf("fetching watchlist: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("The watchlist is empty.")
+		return nil
+	}
+
+	fmt.Println("Watchlist:")
+	for _, e := range entries {
+		fmt.Printf("    %s %s in %d (added %s)\n", e.Title, byDirector(e.Director), e.ReleaseYear, e.Date.Local().Format("2006-01-02"))
+	}
+	return nil
+}
+
+func printWatchHistory(store MovieStore) error {
+	entries, err := store.Viewings()
+	if err != nil {
+		return fmt.Errorf("fetching watch history: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No viewings logged yet.")
+		return nil
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%s  %s %s in %d\n", e.Date.Format("2006-01-02"), e.Title, byDirector(e.Director), e.ReleaseYear)
+	}
+	return nil
+}
+
+// today returns the current local date at midnight UTC, the form dates are
+// stored in.
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}